@@ -6,7 +6,13 @@ class NotificationApp {
     this.userLabel = document.getElementById("user-label");
     this.sendForm = document.getElementById("send-form");
     this.connectionStatus = document.getElementById("connection-status");
+    this.unreadBadge = document.getElementById("unread-badge");
     this.showUnreadOnly = false;
+    this.lastSeenId = null;
+    this.nextCommandId = 1;
+    this.pendingCommands = new Map();
+    this.failedUpgrades = 0;
+    this.eventSource = null;
 
     this.init();
   }
@@ -16,6 +22,7 @@ class NotificationApp {
     this.setupEventListeners();
     this.addFilterButtons();
     await this.loadHistoricalNotifications();
+    await this.loadUnreadCount();
     this.connectWebSocket();
   }
 
@@ -54,7 +61,8 @@ class NotificationApp {
         throw new Error(`HTTP ${response.status}: ${response.statusText}`);
       }
 
-      const notifications = await response.json();
+      const page = await response.json();
+      const notifications = page.items;
 
       // Clear existing notifications
       this.notificationsList.innerHTML = "";
@@ -67,6 +75,10 @@ class NotificationApp {
         notifications.forEach((notification) => {
           this.addNotificationToUI(notification);
         });
+        // Pages are newest first
+        if (!this.lastSeenId) {
+          this.lastSeenId = notifications[0].id;
+        }
       }
 
       const filterText = this.showUnreadOnly ? "unread" : "all";
@@ -77,27 +89,49 @@ class NotificationApp {
     }
   }
 
-  connectWebSocket() {
+  async fetchWebSocketTicket() {
+    const response = await fetch("http://localhost:8080/ws/ticket", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        "X-User-Username": this.user,
+      },
+    });
+
+    if (!response.ok) {
+      throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+    }
+
+    const { ticket } = await response.json();
+    return ticket;
+  }
+
+  async connectWebSocket() {
     try {
       this.updateConnectionStatus("connecting", "Connecting...");
 
+      const ticket = await this.fetchWebSocketTicket();
       const protocol = window.location.protocol === "https:" ? "wss:" : "ws:";
-      const wsUrl = `${protocol}//localhost:8080/ws?username=${encodeURIComponent(
-        this.user
-      )}`;
+      const wsUrl = new URL(`${protocol}//localhost:8080/ws`);
+      if (this.lastSeenId) {
+        wsUrl.searchParams.append("resumeFrom", this.lastSeenId);
+      }
 
-      this.socket = new WebSocket(wsUrl);
+      // Browsers cannot set headers on the upgrade, so the ticket rides along
+      // as a subprotocol next to the one the server selects.
+      this.socket = new WebSocket(wsUrl, ["notifications", `ticket.${ticket}`]);
 
+      let opened = false;
       this.socket.onopen = () => {
+        opened = true;
+        this.failedUpgrades = 0;
         console.log("WebSocket connected");
         this.updateConnectionStatus("connected", "Connected");
       };
 
       this.socket.onmessage = (event) => {
         try {
-          const notification = JSON.parse(event.data);
-          this.addNotificationToUI(notification);
-          this.showNotificationAlert(notification);
+          this.handleEvent(JSON.parse(event.data));
         } catch (error) {
           console.error("Error parsing WebSocket message:", error);
         }
@@ -105,8 +139,27 @@ class NotificationApp {
 
       this.socket.onclose = (event) => {
         console.log("WebSocket disconnected:", event.code, event.reason);
+        this.rejectPendingCommands(new Error("WebSocket disconnected"));
+
+        // 1012: the instance is shutting down. Reconnect soon, spread out so
+        // that its clients do not all land on the others at once.
+        if (event.code === 1012) {
+          this.updateConnectionStatus("connecting", "Server restarting...");
+          setTimeout(() => this.connectWebSocket(), 500 + Math.random() * 2000);
+          return;
+        }
+
         this.updateConnectionStatus("disconnected", "Disconnected");
 
+        // Some proxies break the upgrade; after a few failed attempts fall
+        // back to Server-Sent Events.
+        if (!opened && ++this.failedUpgrades >= 3) {
+          console.log("WebSocket unavailable, falling back to Server-Sent Events");
+          this.socket = null;
+          this.connectEventStream();
+          return;
+        }
+
         // Attempt to reconnect after 3 seconds
         setTimeout(() => {
           console.log("Attempting to reconnect...");
@@ -121,6 +174,235 @@ class NotificationApp {
     } catch (error) {
       console.error("Failed to create WebSocket connection:", error);
       this.updateConnectionStatus("disconnected", "Failed to Connect");
+
+      setTimeout(() => this.connectWebSocket(), 3000);
+    }
+  }
+
+  async connectEventStream() {
+    try {
+      this.updateConnectionStatus("connecting", "Connecting...");
+
+      const ticket = await this.fetchWebSocketTicket();
+      const url = new URL("http://localhost:8080/notifications/stream");
+      url.searchParams.append("ticket", ticket);
+      if (this.lastSeenId) {
+        url.searchParams.append("lastEventId", this.lastSeenId);
+      }
+
+      this.eventSource = new EventSource(url);
+
+      this.eventSource.onopen = () => {
+        console.log("Event stream connected");
+        this.updateConnectionStatus("connected", "Connected (SSE)");
+      };
+
+      ["notification", "read", "archived", "deleted", "badge", "resumed"].forEach(
+        (type) => {
+          this.eventSource.addEventListener(type, (event) => {
+            try {
+              this.handleEvent(JSON.parse(event.data));
+            } catch (error) {
+              console.error("Error parsing event stream message:", error);
+            }
+          });
+        }
+      );
+
+      // EventSource retries on its own, but not once the server has
+      // rejected the request, which happens when the ticket has expired.
+      this.eventSource.onerror = () => {
+        if (this.eventSource.readyState !== EventSource.CLOSED) {
+          this.updateConnectionStatus("connecting", "Reconnecting...");
+          return;
+        }
+        this.updateConnectionStatus("disconnected", "Disconnected");
+        setTimeout(() => this.connectEventStream(), 3000);
+      };
+    } catch (error) {
+      console.error("Failed to open event stream:", error);
+      this.updateConnectionStatus("disconnected", "Failed to Connect");
+
+      setTimeout(() => this.connectEventStream(), 3000);
+    }
+  }
+
+  // sendCommand resolves with the payload of the result correlated by id,
+  // or rejects with the error the server answered with.
+  sendCommand(type, payload) {
+    if (!this.socket || this.socket.readyState !== WebSocket.OPEN) {
+      return Promise.reject(new Error("WebSocket not connected"));
+    }
+
+    const id = String(this.nextCommandId++);
+    return new Promise((resolve, reject) => {
+      this.pendingCommands.set(id, { resolve, reject });
+      this.socket.send(JSON.stringify({ v: 1, type, id, payload }));
+    });
+  }
+
+  settleCommand(event) {
+    const pending = this.pendingCommands.get(event.id);
+    if (!pending) {
+      if (event.type === "error") {
+        console.error("WebSocket error:", event.payload);
+      }
+      return;
+    }
+
+    this.pendingCommands.delete(event.id);
+    if (event.type === "error") {
+      pending.reject(new Error(`${event.payload.code}: ${event.payload.message}`));
+    } else {
+      pending.resolve(event.payload);
+    }
+  }
+
+  rejectPendingCommands(error) {
+    this.pendingCommands.forEach(({ reject }) => reject(error));
+    this.pendingCommands.clear();
+  }
+
+  receiveNotification(notification) {
+    this.lastSeenId = notification.id;
+    if (this.socket) {
+      this.sendCommand("ack", { ids: [notification.id] }).catch((error) =>
+        console.error("Error acknowledging notification:", error)
+      );
+    }
+
+    // A replay after reconnecting may repeat what is already shown
+    if (this.findInUI(notification.id)) {
+      return;
+    }
+    this.addNotificationToUI(notification);
+    this.showNotificationAlert(notification);
+  }
+
+  findInUI(id) {
+    return this.notificationsList.querySelector(
+      `[data-notification-id="${CSS.escape(id)}"]`
+    );
+  }
+
+  handleEvent(event) {
+    switch (event.type) {
+      case "notification":
+        this.receiveNotification(event.payload);
+        break;
+      case "result":
+      case "error":
+        this.settleCommand(event);
+        break;
+      case "resumed":
+        console.log(`Caught up on ${event.payload.replayed} notifications`);
+        if (!event.payload.complete) {
+          this.loadHistoricalNotifications();
+        }
+        break;
+      case "read":
+        this.applyReadState(event.payload);
+        break;
+      case "archived":
+        if (event.payload.archived) {
+          this.removeFromUI(event.payload.ids);
+        } else {
+          this.loadHistoricalNotifications();
+        }
+        break;
+      case "deleted":
+        this.removeFromUI(event.payload.ids);
+        break;
+      case "badge":
+        this.updateBadge(event.payload.count);
+        break;
+      default:
+        console.log("Unhandled event:", event);
+    }
+  }
+
+  async loadUnreadCount() {
+    try {
+      const response = await fetch(
+        "http://localhost:8080/notifications/unread-count",
+        {
+          method: "GET",
+          headers: {
+            "Content-Type": "application/json",
+            "X-User-Username": this.user,
+          },
+        }
+      );
+
+      if (!response.ok) {
+        throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+      }
+
+      const { count } = await response.json();
+      this.updateBadge(count);
+    } catch (error) {
+      console.error("Error loading unread count:", error);
+    }
+  }
+
+  updateBadge(count) {
+    this.unreadBadge.textContent = count > 0 ? `(${count})` : "";
+    document.title = count > 0 ? `(${count}) Live Notifications` : "Live Notifications";
+  }
+
+  removeFromUI(ids) {
+    ids.forEach((id) => {
+      const li = this.findInUI(id);
+      if (li) {
+        li.remove();
+      }
+    });
+  }
+
+  applyReadState(change) {
+    const items = this.notificationsList.querySelectorAll(".notification-item");
+    items.forEach((li) => {
+      const matches = change.all
+        ? (!change.sender || li.dataset.sender === change.sender) &&
+          (!change.before || Number(li.dataset.createdAt) < change.before)
+        : (change.ids || []).includes(li.dataset.notificationId);
+
+      if (matches) {
+        li.classList.toggle("read", change.read);
+      }
+    });
+  }
+
+  // markRead goes over the WebSocket when there is one, and over REST when
+  // the client fell back to Server-Sent Events.
+  async markRead(scope) {
+    if (this.socket) {
+      return this.sendCommand("markRead", scope);
+    }
+
+    const path = scope.all ? "read-all" : "read";
+    const response = await fetch(`http://localhost:8080/notifications/${path}`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        "X-User-Username": this.user,
+      },
+      body: scope.all ? undefined : JSON.stringify({ ids: scope.ids }),
+    });
+
+    if (!response.ok) {
+      throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+    }
+    return response.json();
+  }
+
+  async markAllAsRead() {
+    try {
+      const { modified } = await this.markRead({ all: true });
+      console.log(`${modified} notifications marked as read`);
+    } catch (error) {
+      console.error("Error marking all notifications as read:", error);
+      this.showError("Failed to mark notifications as read");
     }
   }
 
@@ -169,8 +451,16 @@ class NotificationApp {
       this.updateFilterButtons(unreadBtn, allBtn);
       this.loadHistoricalNotifications();
     });
+    const markAllBtn = document.createElement("button");
+    markAllBtn.textContent = "Mark all as read";
+    markAllBtn.className = "btn";
+    markAllBtn.style.cssText = unreadBtn.style.cssText;
+    markAllBtn.style.marginLeft = "auto";
+    markAllBtn.addEventListener("click", () => this.markAllAsRead());
+
     filterContainer.appendChild(allBtn);
     filterContainer.appendChild(unreadBtn);
+    filterContainer.appendChild(markAllBtn);
 
     const notificationsSection = document.querySelector(
       ".notifications-section"
@@ -187,6 +477,8 @@ class NotificationApp {
     const li = document.createElement("li");
     li.className = "notification-item";
     li.dataset.notificationId = notification.id;
+    li.dataset.sender = notification.sender;
+    li.dataset.createdAt = notification.createdAt;
 
     if (notification.read) {
       li.classList.add("read");
@@ -216,25 +508,9 @@ class NotificationApp {
     }
 
     try {
-      const response = await fetch(
-        `http://localhost:8080/notifications/${encodeURIComponent(
-          notificationId
-        )}`,
-        {
-          method: "PATCH",
-          headers: {
-            "Content-Type": "application/json",
-            "X-User-Username": this.user,
-          },
-        }
-      );
-
-      if (response.ok) {
-        element.classList.add("read");
-        console.log(`Notification ${notificationId} marked as read`);
-      } else {
-        throw new Error(`HTTP ${response.status}: ${response.statusText}`);
-      }
+      await this.markRead({ ids: [notificationId] });
+      element.classList.add("read");
+      console.log(`Notification ${notificationId} marked as read`);
     } catch (error) {
       console.error("Error marking notification as read:", error);
       this.showError("Failed to mark notification as read");
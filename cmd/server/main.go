@@ -2,37 +2,114 @@ package main
 
 import (
 	"context"
+	"time"
 
 	"github.com/taekwondodev/push-notification-service/internal/api"
+	"github.com/taekwondodev/push-notification-service/internal/broker"
 	"github.com/taekwondodev/push-notification-service/internal/config"
 	"github.com/taekwondodev/push-notification-service/internal/controller"
+	"github.com/taekwondodev/push-notification-service/internal/health"
+	"github.com/taekwondodev/push-notification-service/internal/lifecycle"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/middleware"
 	"github.com/taekwondodev/push-notification-service/internal/repository"
 	"github.com/taekwondodev/push-notification-service/internal/service"
+	"github.com/taekwondodev/push-notification-service/internal/tracing"
 	"github.com/taekwondodev/push-notification-service/internal/websocket"
 )
 
 func main() {
 	cfg := config.Load()
+	if err := logging.Setup(&cfg.Log); err != nil {
+		logging.Fatal("failed to configure logging", "error", err)
+	}
 
-	repo := repository.NewMongoNotificationRepository(cfg.Mongo.URI, cfg.Mongo.Database)
-	defer repo.Close()
+	if err := run(cfg); err != nil {
+		logging.Fatal("service stopped", "error", err)
+	}
+}
+
+// run wires the service and serves until it is told to stop. Each component
+// registers its stop hook as soon as it exists, so that the ones already
+// started are released even when a later one fails to start. On shutdown the
+// hooks run in reverse: HTTP and the hub's connections, the consumer, the
+// broker and fanout, then MongoDB and the traces.
+func run(cfg *config.Config) error {
+	lc := lifecycle.New(cfg.Server.ShutdownTimeout)
+	defer lc.Shutdown()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	lc.OnStop("tracing", shutdownTracing)
+
+	repo, err := repository.NewMongoNotificationRepository(&cfg.Mongo)
+	if err != nil {
+		return err
+	}
+	lc.OnStop("mongo", repo.Close)
+
+	hub := websocket.NewHub(&cfg.WebSocket)
+	fanout, err := broker.NewFanout(cfg)
+	if err != nil {
+		return err
+	}
+	lc.OnStop("fanout", closer(fanout.Close))
+	hub.UseFanout(fanout, cfg.Server.InstanceID)
+	notifService := service.NewNotificationService(repo, hub)
 
-	notifService := service.NewNotificationService(repo)
-	hub := websocket.NewHub()
+	msgBroker, err := broker.New(cfg)
+	if err != nil {
+		return err
+	}
+	lc.OnStop("broker", closer(msgBroker.Close))
+	msgService := service.NewMessagingService(msgBroker, hub, notifService, &cfg.Broker)
 
-	kafkaService := service.NewKafkaService(&cfg.Kafka, hub, notifService)
+	notifController := controller.NewNotificationController(notifService, msgService)
+	authn, err := middleware.NewAuthenticator(&cfg.Auth)
+	if err != nil {
+		return err
+	}
+	tickets := middleware.NewTicketManager(&cfg.Auth)
+	wsController := controller.NewWebSocketController(hub, tickets, notifService)
+	streamController := controller.NewStreamController(hub, notifService)
+	adminController := controller.NewAdminController(msgService)
 
-	notifController := controller.NewNotificationController(notifService, kafkaService)
-	wsController := controller.NewWebSocketController(hub)
+	checks := health.New()
+	checks.AddReadiness("mongo", repo.Ping)
+	checks.AddReadiness("consumer", msgService.CheckConsumer)
+	checks.AddReadiness("broker", msgService.CheckBroker)
+	healthController := controller.NewHealthController(checks)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		if err := kafkaService.StartConsumer(ctx); err != nil {
-			cancel()
-		}
-	}()
+	lc.Go("fanout listener", hub.ListenFanout)
+	lc.Go("consumer", msgService.StartConsumer)
+
+	router := api.SetupRoutes(notifController, wsController, streamController, adminController, healthController, authn, tickets, cfg.Auth.AdminUsers)
+	server := api.NewServer(&cfg.Server, router)
+	// Hijacked WebSocket connections are not tracked by the server, so the
+	// hub closes them as soon as it stops accepting new ones.
+	server.RegisterOnShutdown(hub.Close)
+	lc.OnStop("hub", hub.Shutdown)
+	lc.Go("http", func(context.Context) error { return server.Start() })
+	lc.OnStop("http", server.Shutdown)
+
+	metricsServer := api.NewMetricsServer(&cfg.Server)
+	lc.Go("metrics", func(context.Context) error { return metricsServer.Start() })
+	lc.OnStop("metrics", metricsServer.Shutdown)
+
+	err = lc.Wait()
+
+	// Leave the load balancers time to notice that the instance is going.
+	checks.ShutDown()
+	if err == nil {
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+	return err
+}
 
-	router := api.SetupRoutes(notifController, wsController)
-	server := api.NewServer(cfg.Server.Port, router)
-	server.StartWithGracefulShutdown()
+func closer(close func() error) func(context.Context) error {
+	return func(context.Context) error {
+		return close()
+	}
 }
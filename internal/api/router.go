@@ -7,10 +7,18 @@ import (
 	"github.com/taekwondodev/push-notification-service/internal/middleware"
 )
 
-var router *http.ServeMux
+var (
+	router         *http.ServeMux
+	authenticate   func(middleware.HandlerFunc) middleware.HandlerFunc
+	authenticateWS func(middleware.HandlerFunc) middleware.HandlerFunc
+	authorizeAdmin func(middleware.HandlerFunc) middleware.HandlerFunc
+)
 
-func SetupRoutes(notifC *controller.NotificationController, wsC *controller.WebSocketController) *http.ServeMux {
+func SetupRoutes(notifC *controller.NotificationController, wsC *controller.WebSocketController, streamC *controller.StreamController, adminC *controller.AdminController, healthC *controller.HealthController, authn middleware.Authenticator, tickets *middleware.TicketManager, admins []string) *http.ServeMux {
 	router = http.NewServeMux()
+	authenticate = middleware.AuthMiddleware(authn)
+	authenticateWS = middleware.AuthMiddleware(middleware.ChainAuthenticators(tickets, authn))
+	authorizeAdmin = middleware.AdminMiddleware(admins)
 
 	router.Handle("OPTIONS /", middleware.CorsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
@@ -18,6 +26,13 @@ func SetupRoutes(notifC *controller.NotificationController, wsC *controller.WebS
 
 	setupNotificationRoutes(notifC)
 	setupWSRoutes(wsC)
+	setupStreamRoutes(streamC)
+	setupAdminRoutes(adminC)
+
+	// Probes are neither authenticated nor logged, since the orchestrator
+	// calls them every few seconds.
+	router.Handle("GET /healthz", middleware.ErrorHandler(healthC.Liveness))
+	router.Handle("GET /readyz", middleware.ErrorHandler(healthC.Readiness))
 
 	return router
 }
@@ -25,18 +40,45 @@ func SetupRoutes(notifC *controller.NotificationController, wsC *controller.WebS
 func setupNotificationRoutes(notifC *controller.NotificationController) {
 	router.Handle("POST /notifications", applyPostMiddleware(notifC.CreateNotification))
 	router.Handle("GET /notifications", applyGetMiddleware(notifC.GetNotifications))
+	router.Handle("POST /notifications/read", applyMiddleware(notifC.MarkManyAsRead))
+	router.Handle("POST /notifications/read-all", applyMiddleware(notifC.MarkAllAsRead))
+	router.Handle("GET /notifications/unread-count", applyMiddleware(notifC.GetUnreadCount))
+	router.Handle("POST /notifications/archive", applyMiddleware(notifC.ArchiveMany))
+	router.Handle("POST /notifications/restore", applyMiddleware(notifC.RestoreMany))
+	router.Handle("POST /notifications/delete", applyMiddleware(notifC.DeleteMany))
+	router.Handle("GET /notifications/{id}", applyMiddleware(notifC.GetNotification))
 	router.Handle("PATCH /notifications/{id}", applyMiddleware(notifC.MarkAsRead))
+	router.Handle("DELETE /notifications/{id}", applyMiddleware(notifC.DeleteNotification))
+	router.Handle("POST /notifications/{id}/archive", applyMiddleware(notifC.Archive))
+	router.Handle("POST /notifications/{id}/restore", applyMiddleware(notifC.Restore))
 }
 
 func setupWSRoutes(wsC *controller.WebSocketController) {
+	router.Handle("POST /ws/ticket", applyMiddleware(wsC.IssueTicket))
 	router.Handle("GET /ws", applyWSMiddleware(wsC.HandleConnection))
 }
 
+// The event stream accepts tickets too, since EventSource cannot set headers.
+func setupStreamRoutes(streamC *controller.StreamController) {
+	router.Handle("GET /notifications/stream", applyWSMiddleware(streamC.HandleStream))
+	router.Handle("GET /notifications/poll", applyMiddleware(streamC.Poll))
+}
+
+func setupAdminRoutes(adminC *controller.AdminController) {
+	router.Handle("POST /admin/dlq/replay", applyAdminMiddleware(adminC.ReplayDeadLetters))
+}
+
 func applyMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 	return middleware.CorsMiddleware(
 		middleware.ErrorHandler(
-			middleware.LoggingMiddleware(
-				middleware.AuthMiddleware(h),
+			middleware.RequestIDMiddleware(
+				middleware.TracingMiddleware(
+					middleware.MetricsMiddleware(
+						middleware.LoggingMiddleware(
+							authenticate(h),
+						),
+					),
+				),
 			),
 		),
 	)
@@ -45,9 +87,15 @@ func applyMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 func applyPostMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 	return middleware.CorsMiddleware(
 		middleware.ErrorHandler(
-			middleware.LoggingMiddleware(
-				middleware.AuthMiddleware(
-					middleware.BodyParsingMiddleware(h),
+			middleware.RequestIDMiddleware(
+				middleware.TracingMiddleware(
+					middleware.MetricsMiddleware(
+						middleware.LoggingMiddleware(
+							authenticate(
+								middleware.BodyParsingMiddleware(h),
+							),
+						),
+					),
 				),
 			),
 		),
@@ -57,9 +105,15 @@ func applyPostMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 func applyGetMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 	return middleware.CorsMiddleware(
 		middleware.ErrorHandler(
-			middleware.LoggingMiddleware(
-				middleware.AuthMiddleware(
-					middleware.QueryParsingMiddleware(h),
+			middleware.RequestIDMiddleware(
+				middleware.TracingMiddleware(
+					middleware.MetricsMiddleware(
+						middleware.LoggingMiddleware(
+							authenticate(
+								middleware.QueryParsingMiddleware(h),
+							),
+						),
+					),
 				),
 			),
 		),
@@ -69,7 +123,33 @@ func applyGetMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 func applyWSMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
 	return middleware.CorsMiddleware(
 		middleware.ErrorHandler(
-			middleware.LoggingMiddleware(h),
+			middleware.RequestIDMiddleware(
+				middleware.TracingMiddleware(
+					middleware.MetricsMiddleware(
+						middleware.LoggingMiddleware(
+							authenticateWS(h),
+						),
+					),
+				),
+			),
+		),
+	)
+}
+
+func applyAdminMiddleware(h middleware.HandlerFunc) http.HandlerFunc {
+	return middleware.CorsMiddleware(
+		middleware.ErrorHandler(
+			middleware.RequestIDMiddleware(
+				middleware.TracingMiddleware(
+					middleware.MetricsMiddleware(
+						middleware.LoggingMiddleware(
+							authenticate(
+								authorizeAdmin(h),
+							),
+						),
+					),
+				),
+			),
 		),
 	)
 }
@@ -2,66 +2,58 @@ package api
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
 )
 
 type Server struct {
 	*http.Server
-	shutdownTimeout time.Duration
 }
 
-func NewServer(addr string, router *http.ServeMux) *Server {
+func NewServer(cfg *config.ServerConfig, router *http.ServeMux) *Server {
 	return &Server{
 		Server: &http.Server{
-			Addr:    ":" + addr,
+			Addr:    ":" + cfg.Port,
 			Handler: router,
 		},
-		shutdownTimeout: 10 * time.Second,
 	}
 }
 
-func (s *Server) StartWithGracefulShutdown() {
-	serverErrors := make(chan error, 1)
-
-	go func() {
-		serverErrors <- s.start()
-	}()
-
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
-
-	// Block until we receive a signal or an error
-	select {
-	case err := <-serverErrors:
-		log.Fatalf("Error starting server: %v", err)
-
-	case <-shutdown:
-		log.Println("Starting graceful shutdown...")
-
-		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
-		defer cancel()
-
-		if err := s.shutdown(ctx); err != nil {
-			log.Printf("Could not gracefully shutdown the server: %v", err)
+// NewMetricsServer serves the Prometheus metrics unauthenticated, for the
+// scraper, on a port of their own that is kept off the public network.
+func NewMetricsServer(cfg *config.ServerConfig) *Server {
+	router := http.NewServeMux()
+	router.Handle("GET /metrics", metrics.Handler())
 
-			if err := s.Close(); err != nil {
-				log.Printf("Could not close server: %v", err)
-			}
-		}
-		log.Println("Server gracefully stopped")
+	return &Server{
+		Server: &http.Server{
+			Addr:    ":" + cfg.MetricsPort,
+			Handler: router,
+		},
 	}
 }
 
-func (s *Server) start() error {
-	log.Printf("Server listening on %s", s.Addr)
-	return s.ListenAndServe()
+// Start serves until Shutdown is called.
+func (s *Server) Start() error {
+	slog.Info("server listening", "addr", s.Addr)
+	if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-func (s *Server) shutdown(ctx context.Context) error {
-	return s.Server.Shutdown(ctx)
+// Shutdown stops accepting connections and waits for the requests in flight.
+// Those still running when ctx is done are cut off. Hijacked connections are
+// left to the functions passed to RegisterOnShutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.Server.Shutdown(ctx); err != nil {
+		s.Close()
+		return err
+	}
+	slog.Info("server gracefully stopped")
+	return nil
 }
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+)
+
+var ErrReplayNotSupported = errors.New("broker does not support dead-letter replay")
+
+// FetchIdleTimeout is how long a consumer waits for a message before it
+// reports itself idle and fetches again.
+const FetchIdleTimeout = 10 * time.Second
+
+// Message is a transport-agnostic record. Key is used for partitioning or
+// routing and is always the receiver's username.
+type Message struct {
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Handler processes one message. Other errors are retried until the handler
+// succeeds; an error marked with Permanent sends the message to the
+// dead-letter queue instead.
+type Handler func(ctx context.Context, msg *Message) error
+
+type Broker interface {
+	Publish(ctx context.Context, msg *Message) error
+	// Subscribe blocks, feeding messages to handler until ctx is cancelled or
+	// the subscription fails in a way that would lose messages. Once ctx is
+	// cancelled it fetches nothing more, but lets the message in hand finish
+	// and acknowledges it before returning.
+	Subscribe(ctx context.Context, handler Handler) error
+	// Ping checks that the broker can be reached and is set up to carry
+	// notifications.
+	Ping(ctx context.Context) error
+	// LastProgress is when the consumer last fetched or finished a message,
+	// or found nothing to fetch. It stands still while a message is retried
+	// or a fetch hangs, and is zero until Subscribe has started.
+	LastProgress() time.Time
+	Close() error
+}
+
+// progress tracks the LastProgress of a consumer.
+type progress struct {
+	last atomic.Int64
+}
+
+func (p *progress) mark() {
+	p.last.Store(time.Now().UnixNano())
+}
+
+func (p *progress) LastProgress() time.Time {
+	last := p.last.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// DeadLetterReplayer is implemented by brokers that keep messages aside once
+// their handler has given up on them.
+type DeadLetterReplayer interface {
+	ReplayDeadLetters(ctx context.Context, limit int) (int, error)
+}
+
+func New(cfg *config.Config) (Broker, error) {
+	switch cfg.Broker.Type {
+	case "kafka", "":
+		return NewKafkaBroker(&cfg.Kafka, &cfg.Broker)
+	case "nats":
+		return NewNATSBroker(&cfg.NATS, &cfg.Broker)
+	case "memory":
+		return NewMemoryBroker(&cfg.Broker), nil
+	default:
+		return nil, fmt.Errorf("unknown broker %q", cfg.Broker.Type)
+	}
+}
+
+func observePublish(broker string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.BrokerPublishDuration.WithLabelValues(broker, result).Observe(time.Since(start).Seconds())
+}
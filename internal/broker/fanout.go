@@ -0,0 +1,198 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+// Fanout broadcasts messages to every instance of the service. Unlike a
+// Broker subscription, where each message is handled by one instance, every
+// listener receives every message. Delivery is best effort: messages sent
+// while an instance is down are not redelivered to it.
+type Fanout interface {
+	Broadcast(ctx context.Context, msg *Message) error
+	// Listen blocks, feeding broadcasts to handler until ctx is cancelled.
+	Listen(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+func NewFanout(cfg *config.Config) (Fanout, error) {
+	fanout := cfg.Broker.Fanout
+	if fanout == "" {
+		fanout = cfg.Broker.Type
+	}
+
+	switch fanout {
+	case "kafka", "":
+		return NewKafkaFanout(&cfg.Kafka, cfg.Server.InstanceID), nil
+	case "nats":
+		return NewNATSFanout(&cfg.NATS)
+	case "memory", "none":
+		return localFanout{}, nil
+	default:
+		return nil, fmt.Errorf("unknown fanout %q", fanout)
+	}
+}
+
+// localFanout is used by single-instance deployments, where there is nobody
+// to broadcast to.
+type localFanout struct{}
+
+func (localFanout) Broadcast(ctx context.Context, msg *Message) error {
+	return nil
+}
+
+func (localFanout) Listen(ctx context.Context, handler Handler) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (localFanout) Close() error {
+	return nil
+}
+
+// kafkaFanout gives every instance a consumer group of its own on the fanout
+// topic. Offsets are never committed, so a restarted instance starts from the
+// end of the topic instead of replaying stale pushes, and the group is
+// dropped by Kafka once the instance is gone.
+type kafkaFanout struct {
+	config  *config.KafkaConfig
+	groupID string
+	writer  *kafka.Writer
+}
+
+func NewKafkaFanout(cfg *config.KafkaConfig, instanceID string) *kafkaFanout {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.FanoutTopic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: cfg.BatchTimeout,
+		RequiredAcks: kafka.RequireOne,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				slog.Error("error broadcasting messages", "count", len(messages), "topic", cfg.FanoutTopic, "error", err)
+			}
+		},
+	}
+
+	return &kafkaFanout{
+		config:  cfg,
+		groupID: cfg.GroupID + "-fanout-" + instanceID,
+		writer:  writer,
+	}
+}
+
+func (f *kafkaFanout) Broadcast(ctx context.Context, msg *Message) error {
+	return f.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(msg.Key),
+		Value:   msg.Value,
+		Headers: toKafkaHeaders(msg.Headers),
+	})
+}
+
+func (f *kafkaFanout) Listen(ctx context.Context, handler Handler) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     f.config.Brokers,
+		Topic:       f.config.FanoutTopic,
+		GroupID:     f.groupID,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		StartOffset: kafka.LastOffset,
+	})
+	defer reader.Close()
+
+	slog.Info("kafka fanout listener started", "topic", f.config.FanoutTopic, "group", f.groupID)
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.Error("error fetching kafka fanout message", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		if err := handler(ctx, fromKafkaMessage(msg)); err != nil {
+			slog.Error("error handling kafka fanout message", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		}
+	}
+}
+
+func (f *kafkaFanout) Close() error {
+	return f.writer.Close()
+}
+
+// natsFanout uses core NATS publish/subscribe, which already delivers every
+// message to every subscriber.
+type natsFanout struct {
+	config *config.NATSConfig
+	conn   *nats.Conn
+}
+
+func NewNATSFanout(cfg *config.NATSConfig) (*natsFanout, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("push-notification-service-fanout"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+
+	return &natsFanout{config: cfg, conn: conn}, nil
+}
+
+func (f *natsFanout) Broadcast(ctx context.Context, msg *Message) error {
+	header := nats.Header{}
+	for k, v := range msg.Headers {
+		header.Set(k, v)
+	}
+	header.Set(headerKey, msg.Key)
+
+	return f.conn.PublishMsg(&nats.Msg{
+		Subject: f.config.FanoutSubject,
+		Data:    msg.Value,
+		Header:  header,
+	})
+}
+
+func (f *natsFanout) Listen(ctx context.Context, handler Handler) error {
+	sub, err := f.conn.Subscribe(f.config.FanoutSubject, func(msg *nats.Msg) {
+		m := &Message{
+			Key:     msg.Header.Get(headerKey),
+			Value:   msg.Data,
+			Headers: make(map[string]string, len(msg.Header)),
+		}
+		for k := range msg.Header {
+			if k != headerKey {
+				m.Headers[k] = msg.Header.Get(k)
+			}
+		}
+
+		if err := handler(ctx, m); err != nil {
+			slog.Error("error handling nats fanout message", "error", err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	slog.Info("nats fanout listener started", "subject", f.config.FanoutSubject)
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (f *natsFanout) Close() error {
+	f.conn.Close()
+	return nil
+}
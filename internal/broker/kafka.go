@@ -0,0 +1,281 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+)
+
+const (
+	headerError             = "x-error"
+	headerAttempts          = "x-attempts"
+	headerOriginalTopic     = "x-original-topic"
+	headerOriginalPartition = "x-original-partition"
+	headerOriginalOffset    = "x-original-offset"
+	headerFailedAt          = "x-failed-at"
+
+	// replayIdleTimeout bounds how long a replay waits for the next DLQ
+	// message before deciding the queue has been drained.
+	replayIdleTimeout = 2 * time.Second
+)
+
+type kafkaBroker struct {
+	config    *config.KafkaConfig
+	retry     *config.BrokerConfig
+	writer    *kafka.Writer
+	dlqWriter *kafka.Writer
+	replayMu  sync.Mutex
+	progress
+}
+
+func NewKafkaBroker(cfg *config.KafkaConfig, retry *config.BrokerConfig) (*kafkaBroker, error) {
+	var acks kafka.RequiredAcks
+	if err := acks.UnmarshalText([]byte(cfg.RequiredAcks)); err != nil {
+		return nil, err
+	}
+
+	var compression kafka.Compression
+	if err := compression.UnmarshalText([]byte(cfg.Compression)); err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: cfg.BatchTimeout,
+		RequiredAcks: acks,
+		Compression:  compression,
+	}
+
+	dlqWriter := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.DLQTopic,
+		Balancer:     &kafka.LeastBytes{},
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	return &kafkaBroker{
+		config:    cfg,
+		retry:     retrySettings(retry),
+		writer:    writer,
+		dlqWriter: dlqWriter,
+	}, nil
+}
+
+func (b *kafkaBroker) Publish(ctx context.Context, msg *Message) error {
+	start := time.Now()
+	err := b.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(msg.Key),
+		Value:   msg.Value,
+		Headers: toKafkaHeaders(msg.Headers),
+	})
+	observePublish("kafka", start, err)
+	return err
+}
+
+// Subscribe commits an offset only once its message has been handled or
+// dead-lettered.
+func (b *kafkaBroker) Subscribe(ctx context.Context, handler Handler) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     b.config.Brokers,
+		Topic:       b.config.Topic,
+		GroupID:     b.config.GroupID,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		StartOffset: kafka.LastOffset,
+	})
+	defer reader.Close()
+
+	slog.Info("kafka consumer started", "topic", b.config.Topic, "group", b.config.GroupID)
+	b.mark()
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, FetchIdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("kafka consumer shutting down")
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Nothing to fetch: the consumer is idle, not stuck.
+				b.mark()
+				continue
+			}
+			slog.Error("error fetching kafka message", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(b.retry.RetryBackoff):
+			}
+			continue
+		}
+
+		b.mark()
+		metrics.BrokerConsumerLag.WithLabelValues(strconv.Itoa(msg.Partition)).Set(float64(msg.HighWaterMark - msg.Offset - 1))
+
+		if err := b.handle(ctx, msg, handler); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("kafka consumer shutting down")
+				return ctx.Err()
+			}
+			return err
+		}
+
+		// A message processed while shutting down is still committed.
+		if err := reader.CommitMessages(context.WithoutCancel(ctx), msg); err != nil {
+			slog.Error("error committing kafka offset", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		}
+		b.mark()
+	}
+}
+
+// Ping fetches the metadata of the topic from the cluster.
+func (b *kafkaBroker) Ping(ctx context.Context) error {
+	client := &kafka.Client{Addr: kafka.TCP(b.config.Brokers...)}
+	resp, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{b.config.Topic}})
+	if err != nil {
+		return err
+	}
+	for _, topic := range resp.Topics {
+		if topic.Error != nil {
+			return fmt.Errorf("topic %s: %w", topic.Name, topic.Error)
+		}
+	}
+	return nil
+}
+
+// handle only returns an error when the message could neither be processed
+// nor dead-lettered, in which case its offset must not be committed.
+func (b *kafkaBroker) handle(ctx context.Context, msg kafka.Message, handler Handler) error {
+	ctx = logging.With(ctx, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+
+	attempts, err := deliver(ctx, b.retry, handler, fromKafkaMessage(msg))
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+
+	return b.deadLetter(ctx, msg, err, attempts)
+}
+
+func (b *kafkaBroker) deadLetter(ctx context.Context, msg kafka.Message, cause error, attempts int) error {
+	headers := append(withoutDLQHeaders(msg.Headers),
+		kafka.Header{Key: headerError, Value: []byte(cause.Error())},
+		kafka.Header{Key: headerAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: headerOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: headerOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: headerOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: headerFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	err := b.dlqWriter.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error writing message to dead-letter topic", "dlq_topic", b.config.DLQTopic, "error", err)
+		return err
+	}
+
+	metrics.BrokerDeadLettered.Inc()
+	slog.WarnContext(ctx, "message moved to dead-letter topic", "dlq_topic", b.config.DLQTopic)
+	return nil
+}
+
+// ReplayDeadLetters moves up to limit messages from the dead-letter topic back
+// onto the main topic. Progress is tracked by a dedicated consumer group, so
+// each dead letter is replayed once.
+func (b *kafkaBroker) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     b.config.Brokers,
+		Topic:       b.config.DLQTopic,
+		GroupID:     b.config.GroupID + "-dlq-replay",
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	replayed := 0
+	for replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return replayed, err
+		}
+
+		err = b.writer.WriteMessages(ctx, kafka.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: withoutDLQHeaders(msg.Headers),
+		})
+		if err != nil {
+			return replayed, err
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	slog.InfoContext(ctx, "replayed dead letters", "count", replayed, "dlq_topic", b.config.DLQTopic)
+	return replayed, nil
+}
+
+// Close flushes any batched messages and releases the writers' connections.
+func (b *kafkaBroker) Close() error {
+	return errors.Join(b.writer.Close(), b.dlqWriter.Close())
+}
+
+func fromKafkaMessage(msg kafka.Message) *Message {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	return &Message{
+		Key:     string(msg.Key),
+		Value:   msg.Value,
+		Headers: headers,
+	}
+}
+
+func toKafkaHeaders(headers map[string]string) []kafka.Header {
+	kafkaHeaders := make([]kafka.Header, 0, len(headers))
+	for k, v := range headers {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return kafkaHeaders
+}
+
+func withoutDLQHeaders(headers []kafka.Header) []kafka.Header {
+	kept := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		switch h.Key {
+		case headerError, headerAttempts, headerOriginalTopic, headerOriginalPartition, headerOriginalOffset, headerFailedAt:
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return kept
+}
@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+)
+
+var ErrBrokerClosed = errors.New("broker closed")
+
+const defaultMemoryBufferSize = 1024
+
+// memoryBroker is an in-process channel-based broker for tests and
+// single-node deployments. Messages are lost on restart.
+type memoryBroker struct {
+	retry       *config.BrokerConfig
+	messages    chan *Message
+	closed      chan struct{}
+	closeOnce   sync.Once
+	mu          sync.Mutex
+	deadLetters []*Message
+	progress
+}
+
+func NewMemoryBroker(cfg *config.BrokerConfig) *memoryBroker {
+	size := cfg.MemoryBufferSize
+	if size < 0 {
+		slog.Warn("invalid memory broker buffer size, using the default", "size", size, "default", defaultMemoryBufferSize)
+		size = defaultMemoryBufferSize
+	}
+
+	return &memoryBroker{
+		retry:    retrySettings(cfg),
+		messages: make(chan *Message, size),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, msg *Message) (err error) {
+	defer func(start time.Time) { observePublish("memory", start, err) }(time.Now())
+
+	select {
+	case <-b.closed:
+		return ErrBrokerClosed
+	default:
+	}
+
+	select {
+	case b.messages <- msg:
+		return nil
+	case <-b.closed:
+		return ErrBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *memoryBroker) Ping(ctx context.Context) error {
+	select {
+	case <-b.closed:
+		return ErrBrokerClosed
+	default:
+		return nil
+	}
+}
+
+func (b *memoryBroker) Subscribe(ctx context.Context, handler Handler) error {
+	slog.Info("in-memory consumer started")
+	b.mark()
+
+	idle := time.NewTicker(FetchIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("in-memory consumer shutting down")
+			return ctx.Err()
+		case <-b.closed:
+			return ErrBrokerClosed
+		case <-idle.C:
+			b.mark()
+		case msg := <-b.messages:
+			b.mark()
+			metrics.BrokerConsumerLag.WithLabelValues("all").Set(float64(len(b.messages)))
+			if _, err := deliver(ctx, b.retry, handler, msg); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				b.mu.Lock()
+				b.deadLetters = append(b.deadLetters, msg)
+				b.mu.Unlock()
+				metrics.BrokerDeadLettered.Inc()
+			}
+			b.mark()
+		}
+	}
+}
+
+func (b *memoryBroker) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	b.mu.Lock()
+	n := min(limit, len(b.deadLetters))
+	batch := slices.Clone(b.deadLetters[:n])
+	b.deadLetters = b.deadLetters[n:]
+	b.mu.Unlock()
+
+	for i, msg := range batch {
+		if err := b.Publish(ctx, msg); err != nil {
+			b.mu.Lock()
+			b.deadLetters = append(batch[i:], b.deadLetters...)
+			b.mu.Unlock()
+			return i, err
+		}
+	}
+	return n, nil
+}
+
+func (b *memoryBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+	return nil
+}
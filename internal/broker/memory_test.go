@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+func newTestMemoryBroker(t *testing.T, bufferSize int) *memoryBroker {
+	t.Helper()
+
+	b := NewMemoryBroker(&config.BrokerConfig{
+		RetryBackoff:     10 * time.Millisecond,
+		RetryMaxBackoff:  50 * time.Millisecond,
+		MemoryBufferSize: bufferSize,
+	})
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func (b *memoryBroker) deadLetterKeys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, len(b.deadLetters))
+	for _, msg := range b.deadLetters {
+		keys = append(keys, msg.Key)
+	}
+	return keys
+}
+
+func TestMemoryBrokerDeadLetterAndReplay(t *testing.T) {
+	b := newTestMemoryBroker(t, 16)
+	ctx := context.Background()
+
+	// The first attempt fails for good and the replayed copy goes through.
+	attempts := make(chan *Message, 2)
+	subscribe(t, b, func(ctx context.Context, msg *Message) error {
+		attempts <- msg
+		if len(attempts) == 1 {
+			return Permanent(errors.New("malformed notification"))
+		}
+		return nil
+	})
+
+	if err := b.Publish(ctx, &Message{Key: "alice", Value: []byte("payload")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	eventually(t, "the dead letter", func() bool { return len(b.deadLetterKeys()) == 1 })
+	if len(attempts) != 1 {
+		t.Fatalf("handler ran %d times, want 1 for a permanent error", len(attempts))
+	}
+
+	replayed, err := b.ReplayDeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed != 1 {
+		t.Fatalf("replayed %d messages, want 1", replayed)
+	}
+
+	eventually(t, "the replayed message", func() bool { return len(attempts) == 2 })
+	<-attempts
+	msg := <-attempts
+	if msg.Key != "alice" || string(msg.Value) != "payload" {
+		t.Errorf("replayed message = %q %q", msg.Key, msg.Value)
+	}
+	if keys := b.deadLetterKeys(); len(keys) != 0 {
+		t.Errorf("dead letters left after replay: %v", keys)
+	}
+}
+
+func TestMemoryBrokerRetriesTransientErrors(t *testing.T) {
+	b := newTestMemoryBroker(t, 16)
+
+	done := make(chan int, 1)
+	calls := 0
+	subscribe(t, b, func(ctx context.Context, msg *Message) error {
+		calls++
+		if calls < 3 {
+			return errors.New("database unreachable")
+		}
+		done <- calls
+		return nil
+	})
+
+	if err := b.Publish(context.Background(), &Message{Key: "alice"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case n := <-done:
+		if n != 3 {
+			t.Errorf("handled after %d attempts, want 3", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not handled")
+	}
+	if keys := b.deadLetterKeys(); len(keys) != 0 {
+		t.Errorf("transient errors dead-lettered %v", keys)
+	}
+}
+
+func TestMemoryBrokerReplayKeepsUnpublished(t *testing.T) {
+	// Without a subscriber, a buffer of one takes a single replayed message
+	// and the second publish blocks until the context expires.
+	b := newTestMemoryBroker(t, 1)
+	b.deadLetters = []*Message{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	replayed, err := b.ReplayDeadLetters(ctx, 3)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("replay error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if replayed != 1 {
+		t.Errorf("replayed %d messages, want 1", replayed)
+	}
+
+	want := []string{"b", "c", "d"}
+	if got := b.deadLetterKeys(); !slices.Equal(got, want) {
+		t.Errorf("dead letters = %v, want %v", got, want)
+	}
+	if msg := <-b.messages; msg.Key != "a" {
+		t.Errorf("published %q, want %q", msg.Key, "a")
+	}
+}
+
+func TestMemoryBrokerReplayAfterClose(t *testing.T) {
+	b := newTestMemoryBroker(t, 16)
+	b.deadLetters = []*Message{{Key: "a"}, {Key: "b"}}
+	b.Close()
+
+	replayed, err := b.ReplayDeadLetters(context.Background(), 10)
+	if !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("replay error = %v, want %v", err, ErrBrokerClosed)
+	}
+	if replayed != 0 {
+		t.Errorf("replayed %d messages, want 0", replayed)
+	}
+	if got, want := b.deadLetterKeys(), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("dead letters = %v, want %v", got, want)
+	}
+}
+
+func TestNewMemoryBrokerNegativeBufferSize(t *testing.T) {
+	b := newTestMemoryBroker(t, -1)
+	if cap(b.messages) != defaultMemoryBufferSize {
+		t.Errorf("buffer size = %d, want %d", cap(b.messages), defaultMemoryBufferSize)
+	}
+}
+
+func TestMemoryBrokerProgress(t *testing.T) {
+	b := newTestMemoryBroker(t, 16)
+	if !b.LastProgress().IsZero() {
+		t.Fatal("progress reported before Subscribe")
+	}
+
+	release := make(chan struct{})
+	handled := make(chan struct{})
+	subscribe(t, b, func(ctx context.Context, msg *Message) error {
+		select {
+		case <-release:
+			close(handled)
+			return nil
+		default:
+			return errors.New("database unreachable")
+		}
+	})
+	eventually(t, "the consumer to start", func() bool { return !b.LastProgress().IsZero() })
+
+	if err := b.Publish(context.Background(), &Message{Key: "alice"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// While the message is retried, progress stands still.
+	time.Sleep(100 * time.Millisecond)
+	stuck := b.LastProgress()
+	time.Sleep(200 * time.Millisecond)
+	if got := b.LastProgress(); !got.Equal(stuck) {
+		t.Fatalf("progress advanced from %v to %v while retrying", stuck, got)
+	}
+
+	close(release)
+	<-handled
+	eventually(t, "progress after the message is handled", func() bool { return b.LastProgress().After(stuck) })
+}
@@ -0,0 +1,301 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+)
+
+const (
+	headerKey             = "x-key"
+	headerOriginalSubject = "x-original-subject"
+	headerOriginalSeq     = "x-original-sequence"
+)
+
+// natsBroker publishes every notification on a subject of its own receiver,
+// "<prefix>.<receiver>", and consumes them through a durable pull consumer
+// with explicit acks.
+type natsBroker struct {
+	config   *config.NATSConfig
+	retry    *config.BrokerConfig
+	conn     *nats.Conn
+	js       jetstream.JetStream
+	consumer jetstream.Consumer
+	replayMu sync.Mutex
+	progress
+}
+
+func NewNATSBroker(cfg *config.NATSConfig, retry *config.BrokerConfig) (*natsBroker, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("push-notification-service"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.SubjectPrefix + ".>"},
+		MaxAge:   cfg.MaxAge,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create stream %s: %w", cfg.Stream, err)
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream + "_DLQ",
+		Subjects: []string{cfg.DLQSubjectPrefix + ".>"},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create stream %s_DLQ: %w", cfg.Stream, err)
+	}
+
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.SubjectPrefix + ".>",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create consumer %s: %w", cfg.Durable, err)
+	}
+
+	return &natsBroker{
+		config:   cfg,
+		retry:    retrySettings(retry),
+		conn:     conn,
+		js:       js,
+		consumer: consumer,
+	}, nil
+}
+
+func (b *natsBroker) Publish(ctx context.Context, msg *Message) error {
+	header := nats.Header{}
+	for k, v := range msg.Headers {
+		header.Set(k, v)
+	}
+	header.Set(headerKey, msg.Key)
+
+	start := time.Now()
+	_, err := b.js.PublishMsg(ctx, &nats.Msg{
+		Subject: b.config.SubjectPrefix + "." + subjectToken(msg.Key),
+		Data:    msg.Value,
+		Header:  header,
+	})
+	observePublish("nats", start, err)
+	return err
+}
+
+func (b *natsBroker) Subscribe(ctx context.Context, handler Handler) error {
+	iter, err := b.consumer.Messages()
+	if err != nil {
+		return err
+	}
+	defer iter.Stop()
+
+	slog.Info("nats consumer started", "stream", b.config.Stream, "durable", b.config.Durable)
+	b.mark()
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, FetchIdleTimeout)
+		msg, err := iter.Next(jetstream.NextContext(fetchCtx))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("nats consumer shutting down")
+				return ctx.Err()
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Nothing to fetch: the consumer is idle, not stuck.
+				b.mark()
+				continue
+			}
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return err
+			}
+			slog.Error("error fetching nats message", "error", err)
+			continue
+		}
+
+		b.mark()
+		b.handle(ctx, msg, handler)
+		b.mark()
+	}
+}
+
+// Ping checks the connection and that the stream still exists.
+func (b *natsBroker) Ping(ctx context.Context) error {
+	if !b.conn.IsConnected() {
+		return fmt.Errorf("nats connection is %s", b.conn.Status())
+	}
+	_, err := b.js.Stream(ctx, b.config.Stream)
+	return err
+}
+
+// handle acks a message once it has been processed or dead-lettered, and
+// naks it otherwise so that JetStream redelivers it.
+func (b *natsBroker) handle(ctx context.Context, msg jetstream.Msg, handler Handler) {
+	ctx = logging.With(ctx, "subject", msg.Subject())
+	if md, err := msg.Metadata(); err == nil {
+		ctx = logging.With(ctx, "sequence", md.Sequence.Stream)
+		metrics.BrokerConsumerLag.WithLabelValues("all").Set(float64(md.NumPending))
+	}
+
+	// Every attempt resets the ack timer, so retries do not trigger a
+	// redelivery of the message being retried.
+	keepAlive := func(ctx context.Context, m *Message) error {
+		msg.InProgress()
+		return handler(ctx, m)
+	}
+
+	attempts, err := deliver(ctx, b.retry, keepAlive, fromNATSMessage(msg))
+	if err != nil && ctx.Err() == nil {
+		err = b.deadLetter(ctx, msg, err, attempts)
+	}
+
+	if err != nil {
+		msg.Nak()
+		return
+	}
+	msg.Ack()
+}
+
+func (b *natsBroker) deadLetter(ctx context.Context, msg jetstream.Msg, cause error, attempts int) error {
+	header := nats.Header{}
+	for k, v := range msg.Headers() {
+		header[k] = v
+	}
+	header.Set(headerError, cause.Error())
+	header.Set(headerAttempts, strconv.Itoa(attempts))
+	header.Set(headerOriginalSubject, msg.Subject())
+	header.Set(headerFailedAt, time.Now().UTC().Format(time.RFC3339))
+	if md, err := msg.Metadata(); err == nil {
+		header.Set(headerOriginalSeq, strconv.FormatUint(md.Sequence.Stream, 10))
+	}
+
+	token := strings.TrimPrefix(msg.Subject(), b.config.SubjectPrefix+".")
+	_, err := b.js.PublishMsg(ctx, &nats.Msg{
+		Subject: b.config.DLQSubjectPrefix + "." + token,
+		Data:    msg.Data(),
+		Header:  header,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error moving message to dead-letter stream", "error", err)
+		return err
+	}
+
+	metrics.BrokerDeadLettered.Inc()
+	slog.WarnContext(ctx, "message moved to dead-letter subject", "dlq_subject", b.config.DLQSubjectPrefix+"."+token)
+	return nil
+}
+
+// ReplayDeadLetters republishes up to limit dead letters on their original
+// subject. A dedicated durable consumer tracks which ones were replayed.
+func (b *natsBroker) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	consumer, err := b.js.CreateOrUpdateConsumer(ctx, b.config.Stream+"_DLQ", jetstream.ConsumerConfig{
+		Durable:   b.config.Durable + "-dlq-replay",
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	batch, err := consumer.Fetch(limit, jetstream.FetchMaxWait(replayIdleTimeout))
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for msg := range batch.Messages() {
+		header := nats.Header{}
+		for k, v := range msg.Headers() {
+			switch k {
+			case headerError, headerAttempts, headerOriginalSubject, headerOriginalSeq, headerFailedAt:
+				continue
+			}
+			header[k] = v
+		}
+
+		subject := msg.Headers().Get(headerOriginalSubject)
+		if subject == "" {
+			subject = b.config.SubjectPrefix + "." + strings.TrimPrefix(msg.Subject(), b.config.DLQSubjectPrefix+".")
+		}
+
+		if _, err := b.js.PublishMsg(ctx, &nats.Msg{Subject: subject, Data: msg.Data(), Header: header}); err != nil {
+			msg.Nak()
+			return replayed, err
+		}
+
+		if err := msg.Ack(); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return replayed, err
+	}
+
+	slog.InfoContext(ctx, "replayed dead letters", "count", replayed, "dlq_stream", b.config.Stream+"_DLQ")
+	return replayed, nil
+}
+
+func (b *natsBroker) Close() error {
+	if err := b.conn.Flush(); err != nil {
+		b.conn.Close()
+		return err
+	}
+	b.conn.Close()
+	return nil
+}
+
+func fromNATSMessage(msg jetstream.Msg) *Message {
+	headers := make(map[string]string, len(msg.Headers()))
+	for k := range msg.Headers() {
+		headers[k] = msg.Headers().Get(k)
+	}
+
+	key := headers[headerKey]
+	delete(headers, headerKey)
+
+	return &Message{
+		Key:     key,
+		Value:   msg.Data(),
+		Headers: headers,
+	}
+}
+
+// subjectToken makes a username safe to use as a single subject token. Names
+// that already are valid tokens are kept as they are, for readability.
+func subjectToken(key string) string {
+	if key != "" && !strings.HasPrefix(key, "~") && !strings.ContainsAny(key, ".*> \t\r\n") {
+		return key
+	}
+	return "~" + base64.RawURLEncoding.EncodeToString([]byte(key))
+}
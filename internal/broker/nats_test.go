@@ -0,0 +1,281 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+// startNATS runs a JetStream-enabled server in-process for the test.
+func startNATS(t *testing.T) string {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("create nats server: %v", err)
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	return srv.ClientURL()
+}
+
+func newTestNATSBroker(t *testing.T) *natsBroker {
+	t.Helper()
+
+	cfg := &config.NATSConfig{
+		URL:              startNATS(t),
+		Stream:           "NOTIFICATIONS",
+		SubjectPrefix:    "notifications",
+		DLQSubjectPrefix: "notifications-dlq",
+		Durable:          "websocket-notifier",
+		AckWait:          5 * time.Second,
+		MaxAge:           time.Hour,
+	}
+	retry := &config.BrokerConfig{
+		RetryBackoff:    10 * time.Millisecond,
+		RetryMaxBackoff: 50 * time.Millisecond,
+	}
+
+	b, err := NewNATSBroker(cfg, retry)
+	if err != nil {
+		t.Fatalf("create broker: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+// subscribe runs Subscribe in the background until the test ends, or until
+// the returned function is called.
+func subscribe(t *testing.T, b Broker, handler Handler) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Subscribe(ctx, handler)
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// eventually polls check until it succeeds or a few seconds have passed.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func consumerSettled(t *testing.T, b *natsBroker) func() bool {
+	return func() bool {
+		info, err := b.consumer.Info(context.Background())
+		if err != nil {
+			t.Fatalf("consumer info: %v", err)
+		}
+		return info.NumPending == 0 && info.NumAckPending == 0 && info.Delivered.Consumer > 0
+	}
+}
+
+func TestNATSBrokerPublishSubscribeAck(t *testing.T) {
+	b := newTestNATSBroker(t)
+	ctx := context.Background()
+
+	received := make(chan *Message, 1)
+	subscribe(t, b, func(ctx context.Context, msg *Message) error {
+		received <- msg
+		return nil
+	})
+
+	err := b.Publish(ctx, &Message{
+		Key:     "alice",
+		Value:   []byte(`{"message":"hi"}`),
+		Headers: map[string]string{"x-request-id": "req-1"},
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Key != "alice" {
+			t.Errorf("key = %q, want %q", msg.Key, "alice")
+		}
+		if string(msg.Value) != `{"message":"hi"}` {
+			t.Errorf("value = %s", msg.Value)
+		}
+		if got := msg.Headers["x-request-id"]; got != "req-1" {
+			t.Errorf("x-request-id header = %q, want %q", got, "req-1")
+		}
+		if _, ok := msg.Headers[headerKey]; ok {
+			t.Errorf("internal %s header leaked to the handler", headerKey)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	eventually(t, "the message to be acked", consumerSettled(t, b))
+}
+
+func TestNATSBrokerDeadLetterAndReplay(t *testing.T) {
+	b := newTestNATSBroker(t)
+	ctx := context.Background()
+
+	const user = "first.last"
+	original := "notifications." + subjectToken(user)
+	dlqSubject := "notifications-dlq." + subjectToken(user)
+
+	attempts := 0
+	stop := subscribe(t, b, func(ctx context.Context, msg *Message) error {
+		attempts++
+		return Permanent(errors.New("malformed notification"))
+	})
+
+	if err := b.Publish(ctx, &Message{Key: user, Value: []byte("not json")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	dlq, err := b.js.Stream(ctx, "NOTIFICATIONS_DLQ")
+	if err != nil {
+		t.Fatalf("dlq stream: %v", err)
+	}
+
+	var dead *jetstream.RawStreamMsg
+	eventually(t, "the dead letter", func() bool {
+		dead, err = dlq.GetLastMsgForSubject(ctx, dlqSubject)
+		return err == nil
+	})
+	eventually(t, "the failed message to be acked", consumerSettled(t, b))
+	stop()
+
+	if attempts != 1 {
+		t.Errorf("handler ran %d times, want 1 for a permanent error", attempts)
+	}
+	if string(dead.Data) != "not json" {
+		t.Errorf("dead letter data = %q", dead.Data)
+	}
+	if got := dead.Header.Get(headerError); got != "malformed notification" {
+		t.Errorf("%s = %q", headerError, got)
+	}
+	if got := dead.Header.Get(headerAttempts); got != "1" {
+		t.Errorf("%s = %q, want 1", headerAttempts, got)
+	}
+	if got := dead.Header.Get(headerOriginalSubject); got != original {
+		t.Errorf("%s = %q, want %q", headerOriginalSubject, got, original)
+	}
+
+	replayed, err := b.ReplayDeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed != 1 {
+		t.Fatalf("replayed %d messages, want 1", replayed)
+	}
+
+	stream, err := b.js.Stream(ctx, "NOTIFICATIONS")
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	msg, err := stream.GetLastMsgForSubject(ctx, original)
+	if err != nil {
+		t.Fatalf("replayed message not found on %s: %v", original, err)
+	}
+	if msg.Sequence != 2 {
+		t.Errorf("replayed message has sequence %d, want 2", msg.Sequence)
+	}
+	if string(msg.Data) != "not json" {
+		t.Errorf("replayed data = %q", msg.Data)
+	}
+	if got := msg.Header.Get(headerKey); got != user {
+		t.Errorf("replayed %s = %q, want %q", headerKey, got, user)
+	}
+	for _, h := range []string{headerError, headerAttempts, headerOriginalSubject, headerOriginalSeq, headerFailedAt} {
+		if msg.Header.Get(h) != "" {
+			t.Errorf("replayed message still carries %s", h)
+		}
+	}
+
+	// The replay consumer remembers what it has already moved.
+	replayed, err = b.ReplayDeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatalf("second replay: %v", err)
+	}
+	if replayed != 0 {
+		t.Errorf("second replay moved %d messages, want 0", replayed)
+	}
+}
+
+func TestSubjectToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		encoded bool
+	}{
+		{"plain", "alice", false},
+		{"dash and digits", "bob-42", false},
+		{"dot", "first.last", true},
+		{"wildcard", "a*b", true},
+		{"full wildcard", "a>b", true},
+		{"leading tilde", "~alice", true},
+		{"whitespace", "john doe", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := subjectToken(tt.key)
+
+			if token == "" || strings.ContainsAny(token, ".*> \t\r\n") {
+				t.Fatalf("subjectToken(%q) = %q is not a single subject token", tt.key, token)
+			}
+
+			if !tt.encoded {
+				if token != tt.key {
+					t.Errorf("subjectToken(%q) = %q, want it unchanged", tt.key, token)
+				}
+				return
+			}
+
+			if !strings.HasPrefix(token, "~") {
+				t.Fatalf("subjectToken(%q) = %q, want an encoded token", tt.key, token)
+			}
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, "~"))
+			if err != nil {
+				t.Fatalf("decode %q: %v", token, err)
+			}
+			if string(decoded) != tt.key {
+				t.Errorf("token %q decodes to %q, want %q", token, decoded, tt.key)
+			}
+		})
+	}
+}
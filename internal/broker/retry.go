@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+)
+
+const (
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// permanentError marks a message that will never be processed successfully,
+// so retrying it is pointless.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// retrySettings copies the retry settings, falling back to the defaults
+// where they would make the consumer retry in a tight loop.
+func retrySettings(cfg *config.BrokerConfig) *config.BrokerConfig {
+	settings := *cfg
+	if settings.RetryBackoff <= 0 {
+		slog.Warn("invalid retry backoff, using the default", "backoff", cfg.RetryBackoff, "default", defaultRetryBackoff)
+		settings.RetryBackoff = defaultRetryBackoff
+	}
+	if settings.RetryMaxBackoff < settings.RetryBackoff {
+		fallback := max(defaultRetryMaxBackoff, settings.RetryBackoff)
+		slog.Warn("retry max backoff below the backoff, using the default", "max_backoff", cfg.RetryMaxBackoff, "default", fallback)
+		settings.RetryMaxBackoff = fallback
+	}
+	return &settings
+}
+
+// deliver runs handler, retrying transient failures with exponential backoff
+// for as long as it takes: an outage of a dependency must not empty the
+// topic into the dead-letter queue. Only Permanent errors are returned for
+// dead-lettering. It returns the number of attempts made and the last
+// error, if any. ctx should carry the position of the message for the logs.
+//
+// Cancelling ctx stops the retries but not the attempt in progress, whose
+// handler gets a context that is never cancelled: on shutdown, the message
+// in hand is processed to the end rather than abandoned halfway.
+func deliver(ctx context.Context, cfg *config.BrokerConfig, handler Handler, msg *Message) (int, error) {
+	ctx = logging.With(ctx, "user", msg.Key)
+	backoff := cfg.RetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := handler(context.WithoutCancel(ctx), msg)
+		if err == nil {
+			metrics.BrokerMessagesConsumed.WithLabelValues("processed").Inc()
+			return attempt, nil
+		}
+		metrics.BrokerProcessingErrors.Inc()
+
+		if IsPermanent(err) {
+			slog.ErrorContext(ctx, "giving up on message", "attempts", attempt, "error", err)
+			metrics.BrokerMessagesConsumed.WithLabelValues("failed").Inc()
+			return attempt, err
+		}
+
+		slog.WarnContext(ctx, "error processing message, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, cfg.RetryMaxBackoff)
+	}
+}
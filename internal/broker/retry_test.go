@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+func TestRetrySettings(t *testing.T) {
+	tests := []struct {
+		name           string
+		backoff        time.Duration
+		maxBackoff     time.Duration
+		wantBackoff    time.Duration
+		wantMaxBackoff time.Duration
+	}{
+		{"valid", 100 * time.Millisecond, 5 * time.Second, 100 * time.Millisecond, 5 * time.Second},
+		{"equal", time.Second, time.Second, time.Second, time.Second},
+		{"zero backoff", 0, 5 * time.Second, defaultRetryBackoff, 5 * time.Second},
+		{"negative backoff", -time.Second, 5 * time.Second, defaultRetryBackoff, 5 * time.Second},
+		{"zero everything", 0, 0, defaultRetryBackoff, defaultRetryMaxBackoff},
+		{"max below backoff", time.Second, 10 * time.Millisecond, time.Second, defaultRetryMaxBackoff},
+		{"max below a large backoff", time.Minute, time.Second, time.Minute, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.BrokerConfig{RetryBackoff: tt.backoff, RetryMaxBackoff: tt.maxBackoff}
+
+			got := retrySettings(cfg)
+			if got.RetryBackoff != tt.wantBackoff {
+				t.Errorf("RetryBackoff = %v, want %v", got.RetryBackoff, tt.wantBackoff)
+			}
+			if got.RetryMaxBackoff != tt.wantMaxBackoff {
+				t.Errorf("RetryMaxBackoff = %v, want %v", got.RetryMaxBackoff, tt.wantMaxBackoff)
+			}
+			if cfg.RetryBackoff != tt.backoff || cfg.RetryMaxBackoff != tt.maxBackoff {
+				t.Error("retrySettings modified the configuration it was given")
+			}
+		})
+	}
+}
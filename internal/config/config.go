@@ -2,42 +2,177 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server ServerConfig
-	Mongo  MongoConfig
-	Kafka  KafkaConfig
+	Server    ServerConfig
+	Mongo     MongoConfig
+	Broker    BrokerConfig
+	Kafka     KafkaConfig
+	NATS      NATSConfig
+	WebSocket WebSocketConfig
+	Auth      AuthConfig
+	Tracing   TracingConfig
+	Log       LogConfig
 }
 
 type ServerConfig struct {
 	Port string
+	// MetricsPort serves /metrics apart from the API, so that it can stay on
+	// an internal network.
+	MetricsPort string
+	InstanceID  string
+	// DrainDelay is how long the server keeps serving after reporting not
+	// ready, so that load balancers stop routing to it first.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds the shutdown that follows, from closing
+	// connections to disconnecting from the database.
+	ShutdownTimeout time.Duration
 }
 
 type MongoConfig struct {
-	URI      string
-	Database string
+	URI       string
+	Database  string
+	Retention time.Duration
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers      []string
+	Topic        string
+	GroupID      string
+	BatchSize    int
+	BatchTimeout time.Duration
+	RequiredAcks string
+	Compression  string
+	DLQTopic     string
+	FanoutTopic  string
+}
+
+type NATSConfig struct {
+	URL              string
+	Stream           string
+	SubjectPrefix    string
+	DLQSubjectPrefix string
+	Durable          string
+	AckWait          time.Duration
+	MaxAge           time.Duration
+	FanoutSubject    string
+}
+
+type BrokerConfig struct {
+	Type             string
+	RetryBackoff     time.Duration
+	RetryMaxBackoff  time.Duration
+	MemoryBufferSize int
+	Fanout           string
+	// StallTimeout is how long the consumer may go without progress before
+	// the instance reports not ready.
+	StallTimeout time.Duration
+}
+
+type WebSocketConfig struct {
+	SendBufferSize int
+	WriteTimeout   time.Duration
+	PingInterval   time.Duration
+	OverflowPolicy string
+}
+
+type AuthConfig struct {
+	Mode          string
+	JWTSecret     string
+	JWKSFile      string
+	JWTAudience   string
+	JWTIssuer     string
+	UsernameClaim string
+	TicketSecret  string
+	TicketTTL     time.Duration
+	AdminUsers    []string
+}
+
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	ServiceName  string
+	SampleRatio  float64
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
 }
 
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Port:            getEnv("PORT", "8080"),
+			MetricsPort:     getEnv("METRICS_PORT", "9090"),
+			InstanceID:      getEnv("INSTANCE_ID", defaultInstanceID()),
+			DrainDelay:      getEnvDuration("SHUTDOWN_DRAIN_DELAY", 0),
+			ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
 		},
 		Mongo: MongoConfig{
-			URI:      getEnv("MONGO_URI", "mongodb://mongo:27017"),
-			Database: getEnv("MONGO_DATABASE", "notificationsdb"),
+			URI:       getEnv("MONGO_URI", "mongodb://mongo:27017"),
+			Database:  getEnv("MONGO_DATABASE", "notificationsdb"),
+			Retention: getEnvDuration("MONGO_RETENTION", 0),
+		},
+		Broker: BrokerConfig{
+			Type:             getEnv("BROKER", "kafka"),
+			RetryBackoff:     getEnvDuration("BROKER_RETRY_BACKOFF", 200*time.Millisecond),
+			RetryMaxBackoff:  getEnvDuration("BROKER_RETRY_MAX_BACKOFF", 10*time.Second),
+			MemoryBufferSize: getEnvInt("MEMORY_BROKER_BUFFER_SIZE", 1024),
+			Fanout:           getEnv("FANOUT", ""),
+			StallTimeout:     getEnvDuration("BROKER_STALL_TIMEOUT", time.Minute),
 		},
 		Kafka: KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKER", "kafka:9092")},
-			Topic:   getEnv("KAFKA_TOPIC", "notifications"),
-			GroupID: getEnv("KAFKA_GROUP_ID", "websocket-notifier"),
+			Brokers:      getEnvList("KAFKA_BROKERS", []string{getEnv("KAFKA_BROKER", "kafka:9092")}),
+			Topic:        getEnv("KAFKA_TOPIC", "notifications"),
+			GroupID:      getEnv("KAFKA_GROUP_ID", "websocket-notifier"),
+			BatchSize:    getEnvInt("KAFKA_BATCH_SIZE", 100),
+			BatchTimeout: getEnvDuration("KAFKA_BATCH_TIMEOUT", 10*time.Millisecond),
+			RequiredAcks: getEnv("KAFKA_REQUIRED_ACKS", "all"),
+			Compression:  getEnv("KAFKA_COMPRESSION", "none"),
+			DLQTopic:     getEnv("KAFKA_DLQ_TOPIC", "notifications-dlq"),
+			FanoutTopic:  getEnv("KAFKA_FANOUT_TOPIC", "notifications-fanout"),
+		},
+		NATS: NATSConfig{
+			URL:              getEnv("NATS_URL", "nats://nats:4222"),
+			Stream:           getEnv("NATS_STREAM", "NOTIFICATIONS"),
+			SubjectPrefix:    getEnv("NATS_SUBJECT_PREFIX", "notifications"),
+			DLQSubjectPrefix: getEnv("NATS_DLQ_SUBJECT_PREFIX", "notifications-dlq"),
+			Durable:          getEnv("NATS_DURABLE", "websocket-notifier"),
+			AckWait:          getEnvDuration("NATS_ACK_WAIT", 30*time.Second),
+			MaxAge:           getEnvDuration("NATS_MAX_AGE", 7*24*time.Hour),
+			FanoutSubject:    getEnv("NATS_FANOUT_SUBJECT", "notifications-fanout"),
+		},
+		WebSocket: WebSocketConfig{
+			SendBufferSize: getEnvInt("WS_SEND_BUFFER_SIZE", 64),
+			WriteTimeout:   getEnvDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+			PingInterval:   getEnvDuration("WS_PING_INTERVAL", 30*time.Second),
+			OverflowPolicy: getEnv("WS_OVERFLOW_POLICY", "drop-oldest"),
+		},
+		Auth: AuthConfig{
+			Mode:          getEnv("AUTH_MODE", "header"),
+			JWTSecret:     getEnv("JWT_SECRET", ""),
+			JWKSFile:      getEnv("JWT_JWKS_FILE", ""),
+			JWTAudience:   getEnv("JWT_AUDIENCE", ""),
+			JWTIssuer:     getEnv("JWT_ISSUER", ""),
+			UsernameClaim: getEnv("JWT_USERNAME_CLAIM", "sub"),
+			TicketSecret:  getEnv("WS_TICKET_SECRET", ""),
+			TicketTTL:     getEnvDuration("WS_TICKET_TTL", 30*time.Second),
+			AdminUsers:    getEnvList("ADMIN_USERS", nil),
+		},
+		Tracing: TracingConfig{
+			Exporter:     getEnv("TRACING_EXPORTER", "none"),
+			OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""),
+			ServiceName:  getEnv("OTEL_SERVICE_NAME", "push-notification-service"),
+			SampleRatio:  getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		Log: LogConfig{
+			Level:  getEnv("LOG_LEVEL", "info"),
+			Format: getEnv("LOG_FORMAT", "json"),
 		},
 	}
 }
@@ -48,3 +183,47 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// defaultInstanceID is unique per process on a host and, in containers,
+// per container.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "instance"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+func getEnvList(key string, fallback []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
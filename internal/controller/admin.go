@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/taekwondodev/push-notification-service/internal/broker"
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+	"github.com/taekwondodev/push-notification-service/internal/service"
+)
+
+const (
+	defaultReplayLimit = 100
+	maxReplayLimit     = 10000
+)
+
+type AdminController struct {
+	msgSvc service.MessagingServiceInterface
+}
+
+func NewAdminController(msgSvc service.MessagingServiceInterface) *AdminController {
+	return &AdminController{
+		msgSvc: msgSvc,
+	}
+}
+
+func (c *AdminController) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) error {
+	limit := defaultReplayLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > maxReplayLimit {
+			return customerrors.ErrBadRequest
+		}
+		limit = parsed
+	}
+
+	replayed, err := c.msgSvc.ReplayDeadLetters(r.Context(), limit)
+	if err == broker.ErrReplayNotSupported {
+		return customerrors.ErrNotImplemented
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.ReplayResult{Replayed: replayed})
+}
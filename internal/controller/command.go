@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+	ws "github.com/taekwondodev/push-notification-service/internal/websocket"
+)
+
+// handleMessage runs a client command and answers it with a result or an
+// error event carrying the command's ID.
+func (h *WebSocketController) handleMessage(ctx context.Context, client *ws.Client, message []byte) {
+	var command ws.Command
+	if err := json.Unmarshal(message, &command); err != nil {
+		h.replyError(ctx, client, "", customerrors.ErrBadRequest)
+		return
+	}
+
+	if command.V != 0 && command.V != ws.ProtocolVersion {
+		h.replyError(ctx, client, command.ID, customerrors.ErrUnsupportedVersion)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	result, err := h.runCommand(ctx, client, &command)
+	if err != nil {
+		h.replyError(ctx, client, command.ID, err)
+		return
+	}
+
+	h.hub.Reply(client, ws.Event{Type: ws.EventResult, ID: command.ID, Payload: result})
+}
+
+func (h *WebSocketController) runCommand(ctx context.Context, client *ws.Client, command *ws.Command) (any, error) {
+	switch command.Type {
+	case ws.CommandAck:
+		return h.ack(ctx, client, command.Payload)
+	case ws.CommandMarkRead:
+		return h.markRead(ctx, client, command.Payload)
+	case ws.CommandSubscribe:
+		return h.subscribe(client, command.Payload)
+	case ws.CommandPing:
+		return models.Pong{Time: time.Now().Unix()}, nil
+	default:
+		return nil, customerrors.ErrUnknownCommand
+	}
+}
+
+func (h *WebSocketController) ack(ctx context.Context, client *ws.Client, payload json.RawMessage) (any, error) {
+	var req models.IDsRequest
+	if err := decodePayload(payload, &req); err != nil {
+		return nil, err
+	}
+	if err := checkIDs(req.IDs); err != nil {
+		return nil, err
+	}
+
+	modified, err := h.notifSvc.MarkDelivered(ctx, client.User, req.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.BulkResult{Modified: modified}, nil
+}
+
+func (h *WebSocketController) markRead(ctx context.Context, client *ws.Client, payload json.RawMessage) (any, error) {
+	var req models.MarkReadCommand
+	if err := decodePayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	var modified int64
+	var err error
+	switch {
+	case req.All:
+		modified, err = h.notifSvc.MarkAllAsRead(ctx, client.User, &models.MarkAllReadRequest{
+			Before: req.Before,
+			Sender: req.Sender,
+		})
+	case len(req.IDs) > 0:
+		if err := checkIDs(req.IDs); err != nil {
+			return nil, err
+		}
+		modified, err = h.notifSvc.MarkManyAsRead(ctx, client.User, req.IDs)
+	default:
+		return nil, customerrors.ErrBadRequest
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return models.BulkResult{Modified: modified}, nil
+}
+
+func (h *WebSocketController) subscribe(client *ws.Client, payload json.RawMessage) (any, error) {
+	var req models.SubscribeCommand
+	if err := decodePayload(payload, &req); err != nil {
+		return nil, err
+	}
+
+	for _, event := range req.Events {
+		if !ws.IsSubscribable(event) {
+			return nil, customerrors.ErrBadRequest
+		}
+	}
+
+	client.Subscribe(req.Events)
+	return req, nil
+}
+
+func (h *WebSocketController) replyError(ctx context.Context, client *ws.Client, id string, err error) {
+	if customerrors.GetStatus(err) >= 500 {
+		slog.ErrorContext(ctx, "error handling command", "command_id", id, "error", err)
+	}
+
+	h.hub.Reply(client, ws.Event{
+		Type: ws.EventError,
+		ID:   id,
+		Payload: &customerrors.Error{
+			Code:    customerrors.GetStatus(err),
+			Message: customerrors.GetMessage(err),
+		},
+	})
+}
+
+func decodePayload(payload json.RawMessage, v any) error {
+	if len(payload) == 0 {
+		return customerrors.ErrBadRequest
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return customerrors.ErrBadRequest
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/taekwondodev/push-notification-service/internal/health"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+)
+
+type HealthController struct {
+	checks *health.Checks
+}
+
+func NewHealthController(checks *health.Checks) *HealthController {
+	return &HealthController{
+		checks: checks,
+	}
+}
+
+// Liveness fails only when the process needs a restart, such as when the
+// consumer has stopped.
+func (c *HealthController) Liveness(w http.ResponseWriter, r *http.Request) error {
+	return writeReport(w, c.checks.Live(r.Context()))
+}
+
+// Readiness fails while a dependency is unreachable and once shutdown has
+// started.
+func (c *HealthController) Readiness(w http.ResponseWriter, r *http.Request) error {
+	return writeReport(w, c.checks.Ready(r.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report models.HealthReport) error {
+	status := http.StatusOK
+	if report.Status != models.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	return writeResponse(w, status, report)
+}
@@ -1,23 +1,23 @@
 package controller
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
 	"github.com/taekwondodev/push-notification-service/internal/middleware"
+	"github.com/taekwondodev/push-notification-service/internal/models"
 	"github.com/taekwondodev/push-notification-service/internal/service"
 )
 
 type NotificationController struct {
 	notifSvc *service.NotificationService
-	kafkaSvc *service.KafkaService
+	msgSvc   service.MessagingServiceInterface
 }
 
-func NewNotificationController(notifSvc *service.NotificationService, kafkaSvc *service.KafkaService) *NotificationController {
+func NewNotificationController(notifSvc *service.NotificationService, msgSvc service.MessagingServiceInterface) *NotificationController {
 	return &NotificationController{
 		notifSvc: notifSvc,
-		kafkaSvc: kafkaSvc,
+		msgSvc:   msgSvc,
 	}
 }
 
@@ -26,17 +26,17 @@ func (c *NotificationController) GetNotifications(w http.ResponseWriter, r *http
 	if err != nil {
 		return err
 	}
-	unreadOnly, err := middleware.GetUnreadFromContext(r.Context())
+	query, err := middleware.GetQueryFromContext(r.Context())
 	if err != nil {
 		return err
 	}
 
-	notifications, err := c.notifSvc.GetNotificationsByReceiver(r.Context(), username, unreadOnly)
+	page, err := c.notifSvc.GetNotificationsByReceiver(r.Context(), username, query)
 	if err != nil {
 		return err
 	}
 
-	return c.writeResponse(w, http.StatusOK, notifications)
+	return writeResponse(w, http.StatusOK, page)
 }
 
 func (c *NotificationController) CreateNotification(w http.ResponseWriter, r *http.Request) error {
@@ -45,7 +45,7 @@ func (c *NotificationController) CreateNotification(w http.ResponseWriter, r *ht
 		return err
 	}
 
-	if err := c.kafkaSvc.PublishNotification(r.Context(), notification); err != nil {
+	if err := c.msgSvc.PublishNotification(r.Context(), notification); err != nil {
 		return err
 	}
 
@@ -53,13 +53,49 @@ func (c *NotificationController) CreateNotification(w http.ResponseWriter, r *ht
 	return nil
 }
 
+func (c *NotificationController) GetUnreadCount(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	count, err := c.notifSvc.CountUnread(r.Context(), username)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.UnreadCount{Count: count})
+}
+
+func (c *NotificationController) GetNotification(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	id := r.PathValue("id")
+	if id == "" {
+		return customerrors.ErrBadRequest
+	}
+
+	notification, err := c.notifSvc.GetNotificationByID(r.Context(), username, id)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, notification)
+}
+
 func (c *NotificationController) MarkAsRead(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
 	id := r.PathValue("id")
 	if id == "" {
 		return customerrors.ErrBadRequest
 	}
 
-	if err := c.notifSvc.MarkAsRead(r.Context(), id); err != nil {
+	if err := c.notifSvc.MarkAsRead(r.Context(), username, id); err != nil {
 		return err
 	}
 
@@ -67,8 +103,139 @@ func (c *NotificationController) MarkAsRead(w http.ResponseWriter, r *http.Reque
 	return nil
 }
 
-func (c *NotificationController) writeResponse(w http.ResponseWriter, status int, data interface{}) error {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(data)
+func (c *NotificationController) MarkManyAsRead(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req models.IDsRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if err := checkIDs(req.IDs); err != nil {
+		return err
+	}
+
+	modified, err := c.notifSvc.MarkManyAsRead(r.Context(), username, req.IDs)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.BulkResult{Modified: modified})
+}
+
+func (c *NotificationController) MarkAllAsRead(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var scope models.MarkAllReadRequest
+	if err := readJSON(r, &scope); err != nil {
+		return err
+	}
+
+	modified, err := c.notifSvc.MarkAllAsRead(r.Context(), username, &scope)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.BulkResult{Modified: modified})
+}
+
+func (c *NotificationController) Archive(w http.ResponseWriter, r *http.Request) error {
+	return c.setArchived(w, r, true)
+}
+
+func (c *NotificationController) Restore(w http.ResponseWriter, r *http.Request) error {
+	return c.setArchived(w, r, false)
+}
+
+func (c *NotificationController) ArchiveMany(w http.ResponseWriter, r *http.Request) error {
+	return c.setManyArchived(w, r, true)
+}
+
+func (c *NotificationController) RestoreMany(w http.ResponseWriter, r *http.Request) error {
+	return c.setManyArchived(w, r, false)
+}
+
+func (c *NotificationController) DeleteNotification(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	id := r.PathValue("id")
+	if id == "" {
+		return customerrors.ErrBadRequest
+	}
+
+	if err := c.notifSvc.DeleteNotification(r.Context(), username, id); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (c *NotificationController) DeleteMany(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req models.IDsRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if err := checkIDs(req.IDs); err != nil {
+		return err
+	}
+
+	deleted, err := c.notifSvc.DeleteNotifications(r.Context(), username, req.IDs)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.BulkResult{Modified: deleted})
+}
+
+func (c *NotificationController) setArchived(w http.ResponseWriter, r *http.Request, archived bool) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+	id := r.PathValue("id")
+	if id == "" {
+		return customerrors.ErrBadRequest
+	}
+
+	if err := c.notifSvc.SetArchived(r.Context(), username, id, archived); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (c *NotificationController) setManyArchived(w http.ResponseWriter, r *http.Request, archived bool) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var req models.IDsRequest
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if err := checkIDs(req.IDs); err != nil {
+		return err
+	}
+
+	modified, err := c.notifSvc.SetManyArchived(r.Context(), username, req.IDs, archived)
+	if err != nil {
+		return err
+	}
+
+	return writeResponse(w, http.StatusOK, models.BulkResult{Modified: modified})
 }
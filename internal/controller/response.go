@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+)
+
+// maxBulkIDs bounds the IDs a single bulk request or command may name, as
+// they all end up in one database query.
+const maxBulkIDs = 500
+
+func writeResponse(w http.ResponseWriter, status int, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(data)
+}
+
+// readJSON decodes an optional JSON body; an empty body leaves v untouched.
+func readJSON(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return customerrors.ErrBadRequest
+	}
+	return nil
+}
+
+// checkIDs rejects an empty or oversized list of notification IDs.
+func checkIDs(ids []string) error {
+	if len(ids) == 0 || len(ids) > maxBulkIDs {
+		return customerrors.ErrBadRequest
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/middleware"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+	"github.com/taekwondodev/push-notification-service/internal/service"
+	ws "github.com/taekwondodev/push-notification-service/internal/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxResumeReplay bounds how many missed notifications are replayed on
+	// reconnect; beyond that the client is told to reload its list.
+	maxResumeReplay = 500
+
+	// The lower bound leaves a catching-up poll time to query the store.
+	minPollTimeout     = time.Second
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 60 * time.Second
+)
+
+// StreamController serves the plain HTTP alternatives to the WebSocket,
+// for clients behind proxies that break upgrades.
+type StreamController struct {
+	hub      *ws.Hub
+	notifSvc service.NotificationServiceInterface
+}
+
+func NewStreamController(hub *ws.Hub, notifSvc service.NotificationServiceInterface) *StreamController {
+	return &StreamController{
+		hub:      hub,
+		notifSvc: notifSvc,
+	}
+}
+
+// HandleStream sends the same events as the WebSocket as Server-Sent Events.
+// Notification events carry their ID, so a reconnecting EventSource resumes
+// through Last-Event-ID.
+func (h *StreamController) HandleStream(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	if lastEventID != "" && !primitive.IsValidObjectID(lastEventID) {
+		return customerrors.ErrBadRequest
+	}
+
+	sink, err := ws.NewEventStreamSink(w)
+	if err != nil {
+		return err
+	}
+
+	client := registerSink(r.Context(), h.hub, h.notifSvc, username, sink, lastEventID)
+
+	select {
+	case <-r.Context().Done():
+		h.hub.Unregister(client)
+	case <-client.Done():
+		h.hub.Unregister(client)
+	}
+
+	// The response writer must outlive every write of the client.
+	<-client.Stopped()
+	return nil
+}
+
+// Poll returns the notifications created after "after" right away if there
+// are any. Otherwise it parks the request until the hub delivers an event to
+// the user, or until the timeout, and then returns what was delivered.
+func (h *StreamController) Poll(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	after := r.URL.Query().Get("after")
+	if after != "" && !primitive.IsValidObjectID(after) {
+		return customerrors.ErrBadRequest
+	}
+
+	timeout, err := parsePollTimeout(r.URL.Query().Get("timeout"))
+	if err != nil {
+		return err
+	}
+
+	sink := ws.NewPollSink(after != "")
+	client := registerSink(r.Context(), h.hub, h.notifSvc, username, sink, after)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-sink.Ready():
+	case <-timer.C:
+	case <-client.Done():
+	case <-r.Context().Done():
+	}
+	h.hub.Unregister(client)
+	<-client.Stopped()
+
+	result := models.PollResult{Events: []json.RawMessage{}, LastEventID: after}
+	for _, frame := range sink.Frames() {
+		result.Events = append(result.Events, frame.Data)
+		if frame.ID != "" {
+			result.LastEventID = frame.ID
+		}
+	}
+
+	return writeResponse(w, http.StatusOK, result)
+}
+
+func parsePollTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultPollTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, customerrors.ErrBadRequest
+	}
+	return min(max(timeout, minPollTimeout), maxPollTimeout), nil
+}
+
+// registerSink attaches a sink to the hub. When lastSeen is set, the
+// notifications created after it are replayed before live delivery starts;
+// the client is registered first so that nothing saved in between is lost.
+// The replay outlives the request, but keeps the values of ctx for its logs.
+func registerSink(ctx context.Context, hub *ws.Hub, notifSvc service.NotificationServiceInterface, user string, sink ws.Sink, lastSeen string) *ws.Client {
+	if lastSeen == "" {
+		return hub.Register(user, sink)
+	}
+
+	client := hub.RegisterHeld(user, sink)
+	go resumeClient(context.WithoutCancel(ctx), hub, notifSvc, client, lastSeen)
+	return client
+}
+
+func resumeClient(ctx context.Context, hub *ws.Hub, notifSvc service.NotificationServiceInterface, client *ws.Client, lastSeen string) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	missed, complete, err := notifSvc.FindMissed(ctx, client.User, lastSeen, maxResumeReplay)
+	if err != nil {
+		slog.ErrorContext(ctx, "error finding missed notifications", "conn", client.ID, "last_seen", lastSeen, "error", err)
+	}
+
+	hub.Resume(client, missed, complete)
+}
@@ -1,33 +1,64 @@
 package controller
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/middleware"
+	"github.com/taekwondodev/push-notification-service/internal/service"
 	ws "github.com/taekwondodev/push-notification-service/internal/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type WebSocketController struct {
-	hub *ws.Hub
+	hub      *ws.Hub
+	tickets  *middleware.TicketManager
+	notifSvc service.NotificationServiceInterface
 }
 
 const (
-	readTimeout  = 60 * time.Second
-	pingInterval = 30 * time.Second
+	storeTimeout = 5 * time.Second
+
+	// maxMessageSize bounds a client frame; the largest command is an ack or
+	// markRead naming maxBulkIDs notifications.
+	maxMessageSize = 32 << 10
 )
 
-func NewWebSocketController(hub *ws.Hub) *WebSocketController {
+func NewWebSocketController(hub *ws.Hub, tickets *middleware.TicketManager, notifSvc service.NotificationServiceInterface) *WebSocketController {
 	return &WebSocketController{
-		hub: hub,
+		hub:      hub,
+		tickets:  tickets,
+		notifSvc: notifSvc,
+	}
+}
+
+func (h *WebSocketController) IssueTicket(w http.ResponseWriter, r *http.Request) error {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	ticket, err := h.tickets.Issue(username)
+	if err != nil {
+		return err
 	}
+
+	return writeResponse(w, http.StatusCreated, ticket)
 }
 
 func (h *WebSocketController) HandleConnection(w http.ResponseWriter, r *http.Request) error {
-	username := r.URL.Query().Get("username")
-	if username == "" {
+	username, err := middleware.GetUsernameFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	resumeFrom := r.URL.Query().Get("resumeFrom")
+	if resumeFrom != "" && !primitive.IsValidObjectID(resumeFrom) {
 		return customerrors.ErrBadRequest
 	}
 
@@ -36,30 +67,26 @@ func (h *WebSocketController) HandleConnection(w http.ResponseWriter, r *http.Re
 		return err
 	}
 
-	h.hub.Register(username, conn)
+	client := registerSink(r.Context(), h.hub, h.notifSvc, username, ws.NewConnSink(conn), resumeFrom)
 
-	go h.handleConnectionLifecycle(username, conn)
+	// The connection outlives the request, but its commands are logged with
+	// the request ID and user of the upgrade.
+	ctx := logging.With(context.WithoutCancel(r.Context()), "conn", client.ID)
+	go h.handleConnectionLifecycle(ctx, client, conn)
 	return nil
 }
 
-func (h *WebSocketController) handleConnectionLifecycle(user string, conn *websocket.Conn) {
-	defer func() {
-		conn.Close()
-		h.hub.Unregister(user)
-	}()
+func (h *WebSocketController) handleConnectionLifecycle(ctx context.Context, client *ws.Client, conn *websocket.Conn) {
+	defer h.hub.Unregister(client)
 
 	h.setupConnectionTimeouts(conn)
-
-	pingTicker := time.NewTicker(pingInterval)
-	defer pingTicker.Stop()
-
-	done := make(chan struct{})
-	go h.readMessageLoop(user, conn, done)
-
-	h.pingLoop(conn, done, pingTicker)
+	h.readMessageLoop(ctx, client, conn)
 }
 
 func (h *WebSocketController) setupConnectionTimeouts(conn *websocket.Conn) {
+	conn.SetReadLimit(maxMessageSize)
+
+	readTimeout := h.hub.ReadTimeout()
 	conn.SetReadDeadline(time.Now().Add(readTimeout))
 
 	conn.SetPongHandler(func(string) error {
@@ -68,44 +95,21 @@ func (h *WebSocketController) setupConnectionTimeouts(conn *websocket.Conn) {
 	})
 }
 
-func (h *WebSocketController) readMessageLoop(user string, conn *websocket.Conn, done chan struct{}) {
-	defer close(done)
-
+func (h *WebSocketController) readMessageLoop(ctx context.Context, client *ws.Client, conn *websocket.Conn) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			h.handleReadError(user, err)
+			h.handleReadError(ctx, err)
 			return
 		}
 
-		h.handleMessage(user, message)
-		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		h.handleMessage(ctx, client, message)
+		conn.SetReadDeadline(time.Now().Add(h.hub.ReadTimeout()))
 	}
 }
 
-func (h *WebSocketController) handleMessage(user string, message []byte) {
-	log.Printf("Received message from user %s: %s", user, string(message))
-}
-
-func (h *WebSocketController) handleReadError(user string, err error) {
+func (h *WebSocketController) handleReadError(ctx context.Context, err error) {
 	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-		log.Printf("WebSocket error for user %s: %v", user, err)
+		slog.WarnContext(ctx, "websocket error", "error", err)
 	}
 }
-
-func (h *WebSocketController) pingLoop(conn *websocket.Conn, done chan struct{}, pingTicker *time.Ticker) {
-	for {
-		select {
-		case <-done:
-			return
-		case <-pingTicker.C:
-			if err := h.sendPing(conn); err != nil {
-				return
-			}
-		}
-	}
-}
-
-func (h *WebSocketController) sendPing(conn *websocket.Conn) error {
-	return conn.WriteMessage(websocket.PingMessage, nil)
-}
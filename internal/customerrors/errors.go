@@ -15,10 +15,16 @@ func (e *Error) Error() string {
 
 var (
 	ErrNotAuthenticated     = &Error{Code: 401, Message: "authentication required"}
+	ErrInvalidCredentials   = &Error{Code: 401, Message: "invalid credentials"}
+	ErrForbidden            = &Error{Code: 403, Message: "forbidden"}
 	ErrNotificationNotFound = &Error{Code: 404, Message: "notification not found"}
 	ErrHttpMethodNotAllowed = &Error{Code: 405, Message: "http method not allowed"}
+	ErrDuplicateNotif       = &Error{Code: 409, Message: "notification already exists"}
 	ErrBadRequest           = &Error{Code: 400, Message: "bad request"}
+	ErrUnknownCommand       = &Error{Code: 400, Message: "unknown command"}
+	ErrUnsupportedVersion   = &Error{Code: 400, Message: "unsupported protocol version"}
 	ErrInternalServer       = &Error{Code: 500, Message: "internal server error"}
+	ErrNotImplemented       = &Error{Code: 501, Message: "not implemented"}
 	ErrDbUnreacheable       = &Error{Code: 503, Message: "database unreachable"}
 	ErrDbSSLHandshakeFailed = &Error{Code: 502, Message: "database SSL handshake failed"}
 	ErrDbTimeout            = &Error{Code: 504, Message: "database timeout"}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/models"
+)
+
+// checkTimeout bounds each check, so that a hung dependency turns into a
+// failed probe rather than one the orchestrator gives up on.
+const checkTimeout = 2 * time.Second
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check returns nil when the dependency it covers is usable.
+type Check func(ctx context.Context) error
+
+// Checks holds the liveness and readiness checks of the service. Liveness
+// only covers failures that a restart fixes; readiness also covers the
+// dependencies, and fails for good once shutdown has started.
+type Checks struct {
+	mu           sync.RWMutex
+	liveness     map[string]Check
+	readiness    map[string]Check
+	shuttingDown atomic.Bool
+}
+
+func New() *Checks {
+	return &Checks{
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+// AddLiveness registers a check for both liveness and readiness.
+func (c *Checks) AddLiveness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.liveness[name] = check
+	c.readiness[name] = check
+}
+
+func (c *Checks) AddReadiness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readiness[name] = check
+}
+
+// ShutDown makes the service report not ready, so that it is taken out of
+// rotation while it drains.
+func (c *Checks) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checks) Live(ctx context.Context) models.HealthReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return run(ctx, c.liveness)
+}
+
+func (c *Checks) Ready(ctx context.Context) models.HealthReport {
+	c.mu.RLock()
+	checks := make(map[string]Check, len(c.readiness)+1)
+	for name, check := range c.readiness {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	checks["shutdown"] = func(context.Context) error {
+		if c.shuttingDown.Load() {
+			return ErrShuttingDown
+		}
+		return nil
+	}
+	return run(ctx, checks)
+}
+
+// run executes the checks concurrently.
+func run(ctx context.Context, checks map[string]Check) models.HealthReport {
+	report := models.HealthReport{
+		Status: models.StatusUp,
+		Checks: make(map[string]models.CheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runOne(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != models.StatusUp {
+				report.Status = models.StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func runOne(ctx context.Context, check Check) models.CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := models.CheckResult{
+		Status:     models.StatusUp,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = models.StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
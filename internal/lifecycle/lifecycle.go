@@ -0,0 +1,125 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Manager starts the long-running parts of the service and stops everything
+// in order on shutdown. Stop hooks run in reverse order of registration, like
+// defers, so registering each component as it is created tears the service
+// down from the outside in: connections first, storage last.
+type Manager struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	hooks    []hook
+	stopping bool
+	failed   chan error
+	once     sync.Once
+}
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+func New(timeout time.Duration) *Manager {
+	return &Manager{
+		timeout: timeout,
+		failed:  make(chan error, 1),
+	}
+}
+
+// OnStop registers a hook to run on shutdown. All hooks share the shutdown
+// timeout; once it has passed they still run, with an expired context, so
+// that each gets the chance to release what it holds.
+func (m *Manager) OnStop(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Go runs a component until shutdown, when its context is cancelled and the
+// manager waits for it to return. A component that returns on its own makes
+// the service shut down.
+func (m *Manager) Go(name string, run func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		err := run(ctx)
+
+		m.mu.Lock()
+		stopping := m.stopping
+		m.mu.Unlock()
+		if stopping {
+			return
+		}
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+		select {
+		case m.failed <- fmt.Errorf("%s: %w", name, err):
+		default:
+		}
+	}()
+
+	m.OnStop(name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	})
+}
+
+// Wait blocks until the process is asked to terminate, or until a component
+// fails, in which case it returns the failure.
+func (m *Manager) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		slog.Info("received signal", "signal", sig.String())
+		return nil
+	case err := <-m.failed:
+		return err
+	}
+}
+
+// Shutdown runs the stop hooks once, within the timeout.
+func (m *Manager) Shutdown() {
+	m.once.Do(func() {
+		m.mu.Lock()
+		m.stopping = true
+		hooks := m.hooks
+		m.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+
+		slog.Info("shutting down", "timeout", m.timeout)
+		for i := len(hooks) - 1; i >= 0; i-- {
+			start := time.Now()
+			if err := hooks[i].stop(ctx); err != nil {
+				slog.Error("error stopping component", "component", hooks[i].name, "error", err)
+				continue
+			}
+			slog.Debug("component stopped", "component", hooks[i].name, "duration", time.Since(start))
+		}
+		slog.Info("shutdown complete")
+	})
+}
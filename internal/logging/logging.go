@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+type requestIDKey struct{}
+
+// Setup installs the default logger. Lines logged with a context carry the
+// attributes added to it with With, and the trace and span IDs if any.
+// The standard log package is routed through the same handler.
+func Setup(cfg *config.LogConfig) error {
+	handler, err := newHandler(os.Stdout, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+func newHandler(w io.Writer, cfg *config.LogConfig) (slog.Handler, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(cfg.Format) {
+	case "json", "":
+		return slog.NewJSONHandler(w, opts), nil
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+// With returns a copy of ctx whose log lines carry the given attributes, as
+// key/value pairs or slog.Attr like slog.Logger.With.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := slog.Group("", args...).Value.Group()
+	if prev, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		attrs = append(prev[:len(prev):len(prev)], attrs...)
+	}
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// WithRequestID tags ctx and its log lines with the ID of the request that
+// caused the work, which follows notifications through the broker.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return With(context.WithValue(ctx, requestIDKey{}, id), "request_id", id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Fatal logs at error level and exits, like log.Fatal.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
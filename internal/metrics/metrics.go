@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "notifications"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status. Streaming routes last as long as the connection.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	BrokerPublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "broker_publish_duration_seconds",
+		Help:      "Latency of publishing a message to the broker.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"broker", "result"})
+
+	BrokerMessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_messages_consumed_total",
+		Help:      "Messages consumed from the broker, by final outcome.",
+	}, []string{"result"})
+
+	BrokerProcessingErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_processing_errors_total",
+		Help:      "Failed attempts at processing a consumed message, retries included.",
+	})
+
+	BrokerDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broker_dead_lettered_total",
+		Help:      "Messages moved to the dead-letter queue.",
+	})
+
+	BrokerConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "broker_consumer_lag",
+		Help:      "Messages waiting to be consumed, by partition where the broker has them.",
+	}, []string{"partition"})
+
+	MongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Latency of MongoDB commands.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "result"})
+
+	ConnectedUsers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "hub_connected_users",
+		Help:      "Users with at least one open connection on this instance.",
+	})
+
+	Connections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "hub_connections",
+		Help:      "Open connections on this instance, across WebSocket, SSE and long-poll.",
+	})
+
+	MessagesSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hub_messages_sent_total",
+		Help:      "Messages written to a connection.",
+	})
+
+	MessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hub_messages_dropped_total",
+		Help:      "Messages not delivered to a connection, by reason.",
+	}, []string{"reason"})
+
+	MessagesFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hub_messages_failed_total",
+		Help:      "Messages that could not be encoded or written to a connection.",
+	})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+)
+
+// AdminMiddleware only lets the listed users through. It must run after
+// authentication.
+func AdminMiddleware(admins []string) func(HandlerFunc) HandlerFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			username, err := GetUsernameFromContext(r.Context())
+			if err != nil {
+				return err
+			}
+
+			if !slices.Contains(admins, username) {
+				return customerrors.ErrForbidden
+			}
+
+			return next(w, r)
+		}
+	}
+}
@@ -2,28 +2,56 @@ package middleware
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
+	"github.com/taekwondodev/push-notification-service/internal/config"
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
 )
 
 const UserContextKey string = "username"
 
-func AuthMiddleware(next HandlerFunc) HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		user, err := extractUserFromHeaders(r)
-		if err != nil {
-			return err
-		}
+// Authenticator resolves the username behind a request. Implementations
+// return customerrors.ErrNotAuthenticated when the request carries none of
+// the credentials they understand, and ErrInvalidCredentials when it does
+// but they do not check out.
+type Authenticator interface {
+	Authenticate(r *http.Request) (string, error)
+}
+
+func NewAuthenticator(cfg *config.AuthConfig) (Authenticator, error) {
+	switch cfg.Mode {
+	case "header", "":
+		return HeaderAuthenticator{}, nil
+	case "jwt":
+		return NewJWTAuthenticator(cfg)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.Mode)
+	}
+}
+
+func AuthMiddleware(authn Authenticator) func(HandlerFunc) HandlerFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			user, err := authn.Authenticate(r)
+			if err != nil {
+				return err
+			}
 
-		ctx := context.WithValue(r.Context(), UserContextKey, user)
-		*r = *r.WithContext(ctx)
+			ctx := context.WithValue(r.Context(), UserContextKey, user)
+			*r = *r.WithContext(logging.With(ctx, "user", user))
 
-		return next(w, r)
+			return next(w, r)
+		}
 	}
 }
 
-func extractUserFromHeaders(r *http.Request) (string, error) {
+// HeaderAuthenticator trusts the X-User-Username header. Only use it behind a
+// gateway that strips and rewrites that header.
+type HeaderAuthenticator struct{}
+
+func (HeaderAuthenticator) Authenticate(r *http.Request) (string, error) {
 	username := r.Header.Get("X-User-Username")
 
 	if username == "" {
@@ -33,6 +61,24 @@ func extractUserFromHeaders(r *http.Request) (string, error) {
 	return username, nil
 }
 
+// ChainAuthenticators tries each authenticator in order and stops at the first
+// one that either succeeds or rejects credentials it recognised.
+func ChainAuthenticators(authns ...Authenticator) Authenticator {
+	return authenticatorChain(authns)
+}
+
+type authenticatorChain []Authenticator
+
+func (c authenticatorChain) Authenticate(r *http.Request) (string, error) {
+	for _, authn := range c {
+		user, err := authn.Authenticate(r)
+		if err != customerrors.ErrNotAuthenticated {
+			return user, err
+		}
+	}
+	return "", customerrors.ErrNotAuthenticated
+}
+
 func GetUsernameFromContext(ctx context.Context) (string, error) {
 	usernameVal := ctx.Value(UserContextKey)
 	username, ok := usernameVal.(string)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
 	"github.com/taekwondodev/push-notification-service/internal/models"
@@ -26,6 +27,14 @@ func BodyParsingMiddleware(next HandlerFunc) HandlerFunc {
 			return customerrors.ErrBadRequest
 		}
 
+		if notification.Expired(time.Now()) {
+			return customerrors.ErrBadRequest
+		}
+
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			notification.IdempotencyKey = key
+		}
+
 		sender, err := GetUsernameFromContext(r.Context())
 		if err != nil {
 			return err
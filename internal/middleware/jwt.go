@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+)
+
+// JWTAuthenticator verifies Authorization: Bearer tokens signed with HS256
+// using a shared secret, or with RS256/ES256 using keys from a JWKS file.
+type JWTAuthenticator struct {
+	parser        *jwt.Parser
+	secret        []byte
+	keys          map[string]any
+	usernameClaim string
+}
+
+func NewJWTAuthenticator(cfg *config.AuthConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		secret:        []byte(cfg.JWTSecret),
+		keys:          make(map[string]any),
+		usernameClaim: cfg.UsernameClaim,
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+	}
+
+	methods := a.validMethods()
+	if len(methods) == 0 {
+		return nil, errors.New("jwt auth requires JWT_SECRET or JWT_JWKS_FILE")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	a.parser = jwt.NewParser(opts...)
+
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (string, error) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		return "", customerrors.ErrNotAuthenticated
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(raw, claims, a.keyFunc); err != nil {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	username, ok := claims[a.usernameClaim].(string)
+	if !ok || username == "" {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	return username, nil
+}
+
+func (a *JWTAuthenticator) validMethods() []string {
+	var methods []string
+	if len(a.secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	var hasRSA, hasEC bool
+	for _, key := range a.keys {
+		switch key.(type) {
+		case *rsa.PublicKey:
+			hasRSA = true
+		case *ecdsa.PublicKey:
+			hasEC = true
+		}
+	}
+	if hasRSA {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if hasEC {
+		methods = append(methods, jwt.SigningMethodES256.Alg())
+	}
+
+	return methods
+}
+
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (any, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return a.secret, nil
+	case *jwt.SigningMethodRSA:
+		return a.lookupKey(token, func(key any) bool { _, ok := key.(*rsa.PublicKey); return ok })
+	case *jwt.SigningMethodECDSA:
+		return a.lookupKey(token, func(key any) bool { _, ok := key.(*ecdsa.PublicKey); return ok })
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+}
+
+// lookupKey picks the key named by the token's kid, or the only key of the
+// right type when the token does not name one.
+func (a *JWTAuthenticator) lookupKey(token *jwt.Token, matches func(any) bool) (any, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok := a.keys[kid]; ok && matches(key) {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var found any
+	for _, key := range a.keys {
+		if !matches(key) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("token has no kid and several keys match")
+		}
+		found = key
+	}
+	if found == nil {
+		return nil, errors.New("no matching key")
+	}
+	return found, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func loadJWKS(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %d: %w", i, err)
+		}
+
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,359 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+)
+
+const (
+	testSecret   = "test-secret"
+	testAudience = "push-notification-service"
+	testIssuer   = "https://auth.example.com"
+)
+
+var (
+	rsaKey      = mustRSAKey()
+	otherRSAKey = mustRSAKey()
+	ecKey       = mustECKey()
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey() *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   b64(key.N.Bytes()),
+		E:   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jwk {
+	return jwk{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   b64(key.X.FillBytes(make([]byte, 32))),
+		Y:   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// writeJWKS stores the keys as a JWKS file in the test's temp dir.
+func writeJWKS(t *testing.T, keys ...jwk) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string][]jwk{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub": "alice",
+		"aud": testAudience,
+		"iss": testIssuer,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+// with returns a copy of the valid claims with the given changes applied;
+// a nil value removes the claim.
+func with(changes jwt.MapClaims) jwt.MapClaims {
+	claims := validClaims()
+	for k, v := range changes {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestJWTAuthenticatorAuthenticate(t *testing.T) {
+	hour := time.Hour
+
+	tests := []struct {
+		name    string
+		secret  string
+		jwks    []jwk
+		token   func(t *testing.T) string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "hs256 valid",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", validClaims(), []byte(testSecret))
+			},
+			want: "alice",
+		},
+		{
+			name:    "missing header",
+			secret:  testSecret,
+			wantErr: customerrors.ErrNotAuthenticated,
+		},
+		{
+			name:    "not a bearer token",
+			secret:  testSecret,
+			header:  "Basic YWxpY2U6c2VjcmV0",
+			wantErr: customerrors.ErrNotAuthenticated,
+		},
+		{
+			name:   "hs256 wrong secret",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", validClaims(), []byte("other-secret"))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "expired",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				claims := with(jwt.MapClaims{"exp": time.Now().Add(-hour).Unix()})
+				return sign(t, jwt.SigningMethodHS256, "", claims, []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "not yet valid",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				claims := with(jwt.MapClaims{"nbf": time.Now().Add(hour).Unix()})
+				return sign(t, jwt.SigningMethodHS256, "", claims, []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "missing exp",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"exp": nil}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "wrong audience",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"aud": "another-service"}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "wrong issuer",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"iss": "https://evil.example.com"}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "username claim missing",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"sub": nil}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "username claim not a string",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"sub": 42}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name:   "username claim empty",
+			secret: testSecret,
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", with(jwt.MapClaims{"sub": ""}), []byte(testSecret))
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			// An HS256 token "signed" with the public key must not be
+			// accepted when only asymmetric keys are configured.
+			name: "hs256 rejected with only jwks keys",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "rsa-1", validClaims(), rsaKey.N.Bytes())
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name: "rs256 with kid",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), rsaJWK("rsa-2", otherRSAKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa-2", validClaims(), otherRSAKey)
+			},
+			want: "alice",
+		},
+		{
+			name: "rs256 with kid of another key",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), rsaJWK("rsa-2", otherRSAKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa-1", validClaims(), otherRSAKey)
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name: "rs256 with unknown kid",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "rsa-9", validClaims(), rsaKey)
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name: "rs256 without kid and a single rsa key",
+			jwks: []jwk{rsaJWK("", rsaKey), ecJWK("ec-1", ecKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", validClaims(), rsaKey)
+			},
+			want: "alice",
+		},
+		{
+			name: "rs256 without kid and several rsa keys",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), rsaJWK("rsa-2", otherRSAKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", validClaims(), rsaKey)
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name: "es256 with kid",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodES256, "ec-1", validClaims(), ecKey)
+			},
+			want: "alice",
+		},
+		{
+			name: "es256 without kid",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodES256, "", validClaims(), ecKey)
+			},
+			want: "alice",
+		},
+		{
+			name: "es256 with kid of an rsa key",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey), ecJWK("ec-1", ecKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodES256, "rsa-1", validClaims(), ecKey)
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+		{
+			name: "es256 rejected with only rsa keys",
+			jwks: []jwk{rsaJWK("rsa-1", rsaKey)},
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodES256, "", validClaims(), ecKey)
+			},
+			wantErr: customerrors.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.AuthConfig{
+				JWTSecret:     tt.secret,
+				JWTAudience:   testAudience,
+				JWTIssuer:     testIssuer,
+				UsernameClaim: "sub",
+			}
+			if tt.jwks != nil {
+				cfg.JWKSFile = writeJWKS(t, tt.jwks...)
+			}
+
+			auth, err := NewJWTAuthenticator(cfg)
+			if err != nil {
+				t.Fatalf("NewJWTAuthenticator: %v", err)
+			}
+
+			r := httptest.NewRequest("GET", "/ws", nil)
+			switch {
+			case tt.header != "":
+				r.Header.Set("Authorization", tt.header)
+			case tt.token != nil:
+				r.Header.Set("Authorization", "Bearer "+tt.token(t))
+			}
+
+			got, err := auth.Authenticate(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Authenticate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewJWTAuthenticatorRequiresKeys(t *testing.T) {
+	if _, err := NewJWTAuthenticator(&config.AuthConfig{UsernameClaim: "sub"}); err == nil {
+		t.Fatal("expected an error without JWT_SECRET or JWT_JWKS_FILE")
+	}
+}
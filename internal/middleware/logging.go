@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -11,7 +11,7 @@ import (
 func LoggingMiddleware(next HandlerFunc) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		start := time.Now()
-		log.Printf("Started %s %s", r.Method, r.URL.Path)
+		slog.DebugContext(r.Context(), "request started", "method", r.Method, "path", r.URL.Path)
 
 		err := next(w, r)
 
@@ -21,8 +21,13 @@ func LoggingMiddleware(next HandlerFunc) HandlerFunc {
 			status = customerrors.GetStatus(err)
 		}
 
-		log.Printf("Completed %s %s | Status: %d | Duration: %v",
-			r.Method, r.URL.Path, status, duration)
+		// The authentication middleware has added the user to r by now.
+		attrs := []any{"method", r.Method, "path", r.URL.Path, "status", status, "duration_ms", float64(duration.Microseconds()) / 1000}
+		if status >= http.StatusInternalServerError {
+			slog.ErrorContext(r.Context(), "request failed", append(attrs, "error", err)...)
+		} else {
+			slog.InfoContext(r.Context(), "request completed", attrs...)
+		}
 
 		return err
 	}
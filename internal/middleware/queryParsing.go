@@ -3,36 +3,100 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/models"
 )
 
-const UnreadContextKey string = "unread"
+const QueryContextKey string = "notificationQuery"
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
 
 func QueryParsingMiddleware(next HandlerFunc) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
-		unread := false
-		if unreadStr := r.URL.Query().Get("unread"); unreadStr != "" {
-			unreadOnly, err := strconv.ParseBool(unreadStr)
-			if err != nil {
-				return customerrors.ErrBadRequest
-			}
-			unread = unreadOnly
+		query, err := parseNotificationQuery(r.URL.Query())
+		if err != nil {
+			return err
 		}
 
-		ctx := context.WithValue(r.Context(), UnreadContextKey, unread)
+		ctx := context.WithValue(r.Context(), QueryContextKey, query)
 		*r = *r.WithContext(ctx)
 
 		return next(w, r)
 	}
 }
 
-func GetUnreadFromContext(ctx context.Context) (bool, error) {
-	unreadVal := ctx.Value(UnreadContextKey)
-	unread, ok := unreadVal.(bool)
-	if !ok {
-		return false, customerrors.ErrBadRequest
+func parseNotificationQuery(values url.Values) (*models.NotificationQuery, error) {
+	query := &models.NotificationQuery{
+		Sender: values.Get("sender"),
+		Limit:  defaultPageLimit,
+	}
+
+	if unreadStr := values.Get("unread"); unreadStr != "" {
+		unreadOnly, err := strconv.ParseBool(unreadStr)
+		if err != nil {
+			return nil, customerrors.ErrBadRequest
+		}
+		query.UnreadOnly = unreadOnly
+	}
+
+	if archivedStr := values.Get("archived"); archivedStr != "" {
+		archived, err := strconv.ParseBool(archivedStr)
+		if err != nil {
+			return nil, customerrors.ErrBadRequest
+		}
+		query.Archived = archived
+	}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, customerrors.ErrBadRequest
+		}
+		query.Limit = limit
+	}
+
+	if cursorStr := values.Get("cursor"); cursorStr != "" {
+		cursor, err := models.DecodeCursor(cursorStr)
+		if err != nil {
+			return nil, customerrors.ErrBadRequest
+		}
+		query.Cursor = cursor
+	}
+
+	var err error
+	if query.Since, err = parseTimestamp(values.Get("since")); err != nil {
+		return nil, err
+	}
+	if query.Until, err = parseTimestamp(values.Get("until")); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+func parseTimestamp(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts < 0 {
+		return 0, customerrors.ErrBadRequest
+	}
+	return ts, nil
+}
+
+func GetQueryFromContext(ctx context.Context) (*models.NotificationQuery, error) {
+	queryVal := ctx.Value(QueryContextKey)
+	query, ok := queryVal.(*models.NotificationQuery)
+	if !ok || query == nil {
+		return nil, customerrors.ErrBadRequest
 	}
-	return unread, nil
+	return query, nil
 }
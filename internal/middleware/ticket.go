@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+)
+
+// Browsers cannot set headers on a WebSocket upgrade, so the ticket travels
+// either as ?ticket= or as an extra "ticket.<value>" subprotocol.
+const TicketSubprotocolPrefix = "ticket."
+
+type ticketClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type TicketManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTicketManager(cfg *config.AuthConfig) *TicketManager {
+	secret := []byte(cfg.TicketSecret)
+	if len(secret) == 0 {
+		slog.Warn("WS_TICKET_SECRET not set, tickets are only valid on this instance")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logging.Fatal("failed to generate ticket secret", "error", err)
+		}
+	}
+
+	return &TicketManager{
+		secret: secret,
+		ttl:    cfg.TicketTTL,
+	}
+}
+
+func (t *TicketManager) Issue(username string) (*models.WSTicket, error) {
+	claims := ticketClaims{
+		Subject:   username,
+		ExpiresAt: time.Now().Add(t.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return &models.WSTicket{
+		Ticket:    encoded + "." + t.sign(encoded),
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+func (t *TicketManager) Verify(ticket string) (string, error) {
+	encoded, signature, ok := strings.Cut(ticket, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	var claims ticketClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	if claims.Subject == "" || time.Now().Unix() > claims.ExpiresAt {
+		return "", customerrors.ErrInvalidCredentials
+	}
+
+	return claims.Subject, nil
+}
+
+func (t *TicketManager) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Authenticate accepts a ticket presented as ?ticket= or as a ticket
+// subprotocol on a WebSocket upgrade.
+func (t *TicketManager) Authenticate(r *http.Request) (string, error) {
+	ticket := extractTicket(r)
+	if ticket == "" {
+		return "", customerrors.ErrNotAuthenticated
+	}
+	return t.Verify(ticket)
+}
+
+func extractTicket(r *http.Request) string {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return ticket
+	}
+
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if ticket, ok := strings.CutPrefix(protocol, TicketSubprotocolPrefix); ok {
+				return ticket
+			}
+		}
+	}
+
+	return ""
+}
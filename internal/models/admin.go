@@ -0,0 +1,5 @@
+package models
+
+type ReplayResult struct {
+	Replayed int `json:"replayed"`
+}
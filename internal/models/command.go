@@ -0,0 +1,18 @@
+package models
+
+// MarkReadCommand marks either the listed notifications or, when All is set,
+// every notification within the optional Before/Sender scope as read.
+type MarkReadCommand struct {
+	IDs    []string `json:"ids,omitempty"`
+	All    bool     `json:"all,omitempty"`
+	Before int64    `json:"before,omitempty"`
+	Sender string   `json:"sender,omitempty"`
+}
+
+type SubscribeCommand struct {
+	Events []string `json:"events"`
+}
+
+type Pong struct {
+	Time int64 `json:"time"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "encoding/json"
+
+// ResumeResult ends the replay of a resumed connection. Complete is false
+// when more notifications were missed than a replay carries, in which case
+// the client should reload its list.
+type ResumeResult struct {
+	Replayed int  `json:"replayed"`
+	Complete bool `json:"complete"`
+}
+
+// PollResult holds the events a long-poll request waited for, encoded
+// exactly as on the WebSocket. LastEventID is the ID to pass as "after" in
+// the next request.
+type PollResult struct {
+	Events      []json.RawMessage `json:"events"`
+	LastEventID string            `json:"lastEventId,omitempty"`
+}
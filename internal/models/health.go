@@ -0,0 +1,19 @@
+package models
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// HealthReport is the body of the health endpoints. Status is down as soon
+// as one of the checks is.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+}
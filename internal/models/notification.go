@@ -1,14 +1,24 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Notification struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitzero"`
-	Sender    string             `json:"sender" bson:"sender"`
-	Receiver  string             `json:"receiver" bson:"receiver"`
-	Message   string             `json:"message" bson:"message"`
-	Read      bool               `json:"read" bson:"read,omitzero"`
-	CreatedAt int64              `json:"createdAt" bson:"createdAt,omitzero"`
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitzero"`
+	Sender         string             `json:"sender" bson:"sender"`
+	Receiver       string             `json:"receiver" bson:"receiver"`
+	Message        string             `json:"message" bson:"message"`
+	Read           bool               `json:"read" bson:"read,omitzero"`
+	Archived       bool               `json:"archived" bson:"archived,omitzero"`
+	CreatedAt      int64              `json:"createdAt" bson:"createdAt,omitzero"`
+	ExpiresAt      *time.Time         `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	IdempotencyKey string             `json:"idempotencyKey,omitempty" bson:"idempotencyKey,omitempty"`
+	DeliveredAt    *time.Time         `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+}
+
+func (n *Notification) Expired(now time.Time) bool {
+	return n.ExpiresAt != nil && !n.ExpiresAt.After(now)
 }
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type NotificationQuery struct {
+	UnreadOnly bool
+	Archived   bool
+	Sender     string
+	Since      int64
+	Until      int64
+	Limit      int
+	Cursor     *Cursor
+}
+
+type NotificationPage struct {
+	Items      []Notification `json:"items"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// Cursor points at the last notification of a page. Notifications are
+// ordered by createdAt and then _id, so the pair is unique and stable.
+type Cursor struct {
+	CreatedAt int64
+	ID        primitive.ObjectID
+}
+
+func CursorFor(n *Notification) *Cursor {
+	return &Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+}
+
+func (c *Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt, 10) + ":" + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAtStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := strconv.ParseInt(createdAtStr, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: createdAt, ID: id}, nil
+}
@@ -0,0 +1,38 @@
+package models
+
+type IDsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type MarkAllReadRequest struct {
+	Before int64  `json:"before,omitempty"`
+	Sender string `json:"sender,omitempty"`
+}
+
+type UnreadCount struct {
+	Count int64 `json:"count"`
+}
+
+type BulkResult struct {
+	Modified int64 `json:"modified"`
+}
+
+// ReadStateChange tells a user's other devices which notifications changed
+// read state. Either IDs is set, or All is set together with the optional
+// Before/Sender scope that was applied.
+type ReadStateChange struct {
+	IDs    []string `json:"ids,omitempty"`
+	All    bool     `json:"all,omitempty"`
+	Before int64    `json:"before,omitempty"`
+	Sender string   `json:"sender,omitempty"`
+	Read   bool     `json:"read"`
+}
+
+type ArchiveStateChange struct {
+	IDs      []string `json:"ids"`
+	Archived bool     `json:"archived"`
+}
+
+type DeletedChange struct {
+	IDs []string `json:"ids"`
+}
@@ -0,0 +1,6 @@
+package models
+
+type WSTicket struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
@@ -2,65 +2,111 @@ package repository
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/taekwondodev/push-notification-service/internal/config"
 	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
 	"github.com/taekwondodev/push-notification-service/internal/models"
+	"github.com/taekwondodev/push-notification-service/internal/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type NotificationRepository interface {
 	Save(ctx context.Context, notification *models.Notification) error
-	FindByReceiver(ctx context.Context, receiver string, unreadOnly bool) ([]models.Notification, error)
-	MarkAsRead(ctx context.Context, id string) error
-	Close() error
+	FindByReceiver(ctx context.Context, receiver string, query *models.NotificationQuery) (*models.NotificationPage, error)
+	FindByID(ctx context.Context, receiver, id string) (*models.Notification, error)
+	FindAfter(ctx context.Context, receiver string, after *models.Cursor, limit int) ([]models.Notification, error)
+	CountUnread(ctx context.Context, receiver string) (int64, error)
+	MarkAsRead(ctx context.Context, receiver, id string) error
+	MarkManyAsRead(ctx context.Context, receiver string, ids []string) (int64, error)
+	MarkAllAsRead(ctx context.Context, receiver string, scope *models.MarkAllReadRequest) (int64, error)
+	SetArchived(ctx context.Context, receiver, id string, archived bool) error
+	SetManyArchived(ctx context.Context, receiver string, ids []string, archived bool) (int64, error)
+	Delete(ctx context.Context, receiver, id string) error
+	DeleteMany(ctx context.Context, receiver string, ids []string) (int64, error)
+	MarkDelivered(ctx context.Context, receiver string, ids []string) (int64, error)
+	Close(ctx context.Context) error
 }
 
 type mongoNotificationRepository struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	retention  time.Duration
 }
 
-func NewMongoNotificationRepository(uri, database string) *mongoNotificationRepository {
+func NewMongoNotificationRepository(cfg *config.MongoConfig) (*mongoNotificationRepository, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	clientOpts := options.Client().ApplyURI(uri)
+	clientOpts := options.Client().ApplyURI(cfg.URI).SetMonitor(metrics.MongoMonitor())
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		log.Fatal("failed to connect to database", "error", err)
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatal("failed to connect to database", "error", err)
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
 
-	collection := client.Database(database).Collection("notifications")
+	collection := client.Database(cfg.Database).Collection("notifications")
 
 	repo := &mongoNotificationRepository{
 		client:     client,
 		collection: collection,
+		retention:  cfg.Retention,
 	}
 
 	if err := repo.createIndexes(ctx); err != nil {
-		log.Printf("Warning: failed to create indexes: %v", err)
+		slog.Warn("failed to create indexes", "error", err)
 	}
 
-	return repo
+	return repo, nil
 }
 
-func (r *mongoNotificationRepository) Save(ctx context.Context, notification *models.Notification) error {
-	_, err := r.collection.InsertOne(ctx, notification)
+// Save applies the default retention to notifications without an explicit
+// expiry; the TTL index on expiresAt then removes them.
+func (r *mongoNotificationRepository) Save(ctx context.Context, notification *models.Notification) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "NotificationRepository.Save", trace.WithAttributes(
+		attribute.String("notification.id", notification.ID.Hex()),
+	))
+	defer func() {
+		if err != customerrors.ErrDuplicateNotif {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	if notification.ExpiresAt == nil && r.retention > 0 {
+		createdAt := time.Now()
+		if notification.CreatedAt > 0 {
+			createdAt = time.Unix(notification.CreatedAt, 0)
+		}
+		expiresAt := createdAt.Add(r.retention)
+		notification.ExpiresAt = &expiresAt
+	}
+
+	_, err = r.collection.InsertOne(ctx, notification)
+	if mongo.IsDuplicateKeyError(err) {
+		return customerrors.ErrDuplicateNotif
+	}
 	return err
 }
 
-func (r *mongoNotificationRepository) FindByReceiver(ctx context.Context, receiver string, unreadOnly bool) ([]models.Notification, error) {
-	mongoFilter := r.buildMongoFilter(receiver, unreadOnly)
-	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+func (r *mongoNotificationRepository) FindByReceiver(ctx context.Context, receiver string, query *models.NotificationQuery) (*models.NotificationPage, error) {
+	mongoFilter := r.buildMongoFilter(receiver, query)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(query.Limit) + 1)
 
 	cursor, err := r.collection.Find(ctx, mongoFilter, opts)
 	if err != nil {
@@ -68,7 +114,73 @@ func (r *mongoNotificationRepository) FindByReceiver(ctx context.Context, receiv
 	}
 	defer cursor.Close(ctx)
 
-	var notifications []models.Notification
+	notifications := make([]models.Notification, 0, query.Limit+1)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+
+	page := &models.NotificationPage{Items: notifications}
+	if len(notifications) > query.Limit {
+		page.Items = notifications[:query.Limit]
+		page.NextCursor = models.CursorFor(&page.Items[query.Limit-1]).Encode()
+	}
+
+	return page, nil
+}
+
+func (r *mongoNotificationRepository) CountUnread(ctx context.Context, receiver string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{
+		"receiver": receiver,
+		"read":     bson.M{"$ne": true},
+		"archived": bson.M{"$ne": true},
+		"$or":      notExpired(time.Now()),
+	})
+}
+
+// FindByID and MarkAsRead filter on the receiver as well as the ID, so that
+// someone else's notification is indistinguishable from a missing one.
+func (r *mongoNotificationRepository) FindByID(ctx context.Context, receiver, id string) (*models.Notification, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, customerrors.ErrNotificationNotFound
+	}
+
+	var notification models.Notification
+	err = r.collection.FindOne(ctx, bson.M{"_id": objID, "receiver": receiver}).Decode(&notification)
+	if err == mongo.ErrNoDocuments {
+		return nil, customerrors.ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+// FindAfter returns the oldest notifications created after the cursor, in
+// the order they were created, so that a reconnecting client can catch up.
+func (r *mongoNotificationRepository) FindAfter(ctx context.Context, receiver string, after *models.Cursor, limit int) ([]models.Notification, error) {
+	mongoFilter := bson.M{
+		"receiver": receiver,
+		"$and": []bson.M{
+			{"$or": notExpired(time.Now())},
+			{"$or": []bson.M{
+				{"createdAt": bson.M{"$gt": after.CreatedAt}},
+				{"createdAt": after.CreatedAt, "_id": bson.M{"$gt": after.ID}},
+			}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, mongoFilter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]models.Notification, 0, limit)
 	if err := cursor.All(ctx, &notifications); err != nil {
 		return nil, err
 	}
@@ -76,15 +188,15 @@ func (r *mongoNotificationRepository) FindByReceiver(ctx context.Context, receiv
 	return notifications, nil
 }
 
-func (r *mongoNotificationRepository) MarkAsRead(ctx context.Context, id string) error {
+func (r *mongoNotificationRepository) MarkAsRead(ctx context.Context, receiver, id string) error {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return err
+		return customerrors.ErrNotificationNotFound
 	}
 
 	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": objID},
+		bson.M{"_id": objID, "receiver": receiver},
 		bson.M{"$set": bson.M{"read": true}},
 	)
 	if err != nil {
@@ -98,30 +210,213 @@ func (r *mongoNotificationRepository) MarkAsRead(ctx context.Context, id string)
 	return nil
 }
 
-func (r *mongoNotificationRepository) Close() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (r *mongoNotificationRepository) MarkManyAsRead(ctx context.Context, receiver string, ids []string) (int64, error) {
+	objIDs, err := toObjectIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": objIDs}, "receiver": receiver},
+		bson.M{"$set": bson.M{"read": true}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoNotificationRepository) MarkAllAsRead(ctx context.Context, receiver string, scope *models.MarkAllReadRequest) (int64, error) {
+	mongoFilter := bson.M{"receiver": receiver, "read": bson.M{"$ne": true}}
+	if scope.Before > 0 {
+		mongoFilter["createdAt"] = bson.M{"$lt": scope.Before}
+	}
+	if scope.Sender != "" {
+		mongoFilter["sender"] = scope.Sender
+	}
+
+	result, err := r.collection.UpdateMany(ctx, mongoFilter, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoNotificationRepository) SetArchived(ctx context.Context, receiver, id string, archived bool) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return customerrors.ErrNotificationNotFound
+	}
+
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": objID, "receiver": receiver},
+		bson.M{"$set": bson.M{"archived": archived}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return customerrors.ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+func (r *mongoNotificationRepository) SetManyArchived(ctx context.Context, receiver string, ids []string, archived bool) (int64, error) {
+	objIDs, err := toObjectIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": objIDs}, "receiver": receiver},
+		bson.M{"$set": bson.M{"archived": archived}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoNotificationRepository) Delete(ctx context.Context, receiver, id string) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return customerrors.ErrNotificationNotFound
+	}
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objID, "receiver": receiver})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return customerrors.ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+func (r *mongoNotificationRepository) DeleteMany(ctx context.Context, receiver string, ids []string) (int64, error) {
+	objIDs, err := toObjectIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": objIDs}, "receiver": receiver})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// MarkDelivered records when a client first acknowledged each notification.
+func (r *mongoNotificationRepository) MarkDelivered(ctx context.Context, receiver string, ids []string) (int64, error) {
+	objIDs, err := toObjectIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": objIDs}, "receiver": receiver, "deliveredAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deliveredAt": time.Now().UTC()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoNotificationRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx, readpref.Primary())
+}
+
+// Close waits for the operations in progress until ctx is done, then
+// disconnects.
+func (r *mongoNotificationRepository) Close(ctx context.Context) error {
 	return r.client.Disconnect(ctx)
 }
 
-func (r *mongoNotificationRepository) buildMongoFilter(receiver string, unread bool) bson.M {
+func (r *mongoNotificationRepository) buildMongoFilter(receiver string, query *models.NotificationQuery) bson.M {
 	mongoFilter := bson.M{}
 	mongoFilter["receiver"] = receiver
 
-	if unread {
-		mongoFilter["$or"] = []bson.M{
+	conditions := []bson.M{{"$or": notExpired(time.Now())}}
+
+	if query.UnreadOnly {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
 			{"read": false},
 			{"read": bson.M{"$exists": false}},
-		}
+		}})
+	}
+
+	if query.Archived {
+		mongoFilter["archived"] = true
+	} else {
+		mongoFilter["archived"] = bson.M{"$ne": true}
+	}
+
+	if query.Sender != "" {
+		mongoFilter["sender"] = query.Sender
 	}
 
+	createdAt := bson.M{}
+	if query.Since > 0 {
+		createdAt["$gte"] = query.Since
+	}
+	if query.Until > 0 {
+		createdAt["$lt"] = query.Until
+	}
+	if len(createdAt) > 0 {
+		mongoFilter["createdAt"] = createdAt
+	}
+
+	if c := query.Cursor; c != nil {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"createdAt": bson.M{"$lt": c.CreatedAt}},
+			{"createdAt": c.CreatedAt, "_id": bson.M{"$lt": c.ID}},
+		}})
+	}
+
+	mongoFilter["$and"] = conditions
+
 	return mongoFilter
 }
 
+// notExpired hides notifications whose expiry has passed but which the TTL
+// monitor, running about once a minute, has not removed yet.
+func notExpired(now time.Time) []bson.M {
+	return []bson.M{
+		{"expiresAt": bson.M{"$exists": false}},
+		{"expiresAt": bson.M{"$gt": now}},
+	}
+}
+
+func toObjectIDs(ids []string) ([]primitive.ObjectID, error) {
+	objIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, customerrors.ErrBadRequest
+		}
+		objIDs = append(objIDs, objID)
+	}
+	return objIDs, nil
+}
+
 func (r *mongoNotificationRepository) createIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
 		{
-			Keys: bson.D{{Key: "receiver", Value: 1}, {Key: "createdAt", Value: -1}},
+			Keys: bson.D{{Key: "receiver", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
 		},
 		{
 			Keys: bson.D{{Key: "sender", Value: 1}, {Key: "createdAt", Value: -1}},
@@ -129,6 +424,16 @@ func (r *mongoNotificationRepository) createIndexes(ctx context.Context) error {
 		{
 			Keys: bson.D{{Key: "receiver", Value: 1}, {Key: "read", Value: 1}},
 		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "sender", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$exists": true}}),
+		},
 	}
 
 	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/broker"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
+	"github.com/taekwondodev/push-notification-service/internal/logging"
+	"github.com/taekwondodev/push-notification-service/internal/models"
+	"github.com/taekwondodev/push-notification-service/internal/tracing"
+	"github.com/taekwondodev/push-notification-service/internal/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerRequestID carries the ID of the request that published a
+// notification, so that the consumer's logs can be matched with it.
+const headerRequestID = "x-request-id"
+
+var (
+	ErrConsumerStopped    = errors.New("consumer stopped")
+	ErrConsumerNotStarted = errors.New("consumer not started")
+)
+
+const defaultStallTimeout = time.Minute
+
+type MessagingServiceInterface interface {
+	PublishNotification(ctx context.Context, notification *models.Notification) error
+	StartConsumer(ctx context.Context) error
+	ReplayDeadLetters(ctx context.Context, limit int) (int, error)
+}
+
+// MessagingService moves notifications through the broker: it publishes them
+// on behalf of the REST API and persists and delivers them as they come back.
+type MessagingService struct {
+	broker   broker.Broker
+	hub      *websocket.Hub
+	notifSvc *NotificationService
+
+	// The consumer is considered stuck once it has made no progress for
+	// stallTimeout.
+	stallTimeout time.Duration
+
+	// consumerErr is why StartConsumer returned, once it has.
+	mu          sync.Mutex
+	stopped     bool
+	consumerErr error
+}
+
+func NewMessagingService(b broker.Broker, hub *websocket.Hub, notifSvc *NotificationService, cfg *config.BrokerConfig) *MessagingService {
+	// An idle consumer only reports progress every FetchIdleTimeout, so a
+	// shorter stall timeout would make it flap.
+	stallTimeout := cfg.StallTimeout
+	if stallTimeout <= broker.FetchIdleTimeout {
+		slog.Warn("stall timeout too short, using the default", "timeout", cfg.StallTimeout, "default", defaultStallTimeout)
+		stallTimeout = defaultStallTimeout
+	}
+
+	return &MessagingService{
+		broker:       b,
+		hub:          hub,
+		notifSvc:     notifSvc,
+		stallTimeout: stallTimeout,
+	}
+}
+
+// PublishNotification assigns the notification its ID up front, so that a
+// redelivered message collides with the stored copy instead of duplicating it.
+// The trace context travels in the message headers to the consumer.
+func (m *MessagingService) PublishNotification(ctx context.Context, notification *models.Notification) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "MessagingService.Publish", trace.WithSpanKind(trace.SpanKindProducer))
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
+	notification.ID = primitive.NewObjectID()
+	notification.CreatedAt = time.Now().Unix()
+	notification.Read = false
+	notification.Archived = false
+	notification.DeliveredAt = nil
+
+	span.SetAttributes(
+		attribute.String("user", notification.Receiver),
+		attribute.String("notification.id", notification.ID.Hex()),
+	)
+
+	value, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string)
+	if id := logging.RequestID(ctx); id != "" {
+		headers[headerRequestID] = id
+	}
+	tracing.Inject(ctx, headers)
+	return m.broker.Publish(ctx, &broker.Message{
+		Key:     notification.Receiver,
+		Value:   value,
+		Headers: headers,
+	})
+}
+
+func (m *MessagingService) StartConsumer(ctx context.Context) error {
+	err := m.broker.Subscribe(ctx, m.processMessage)
+
+	m.mu.Lock()
+	m.stopped = true
+	m.consumerErr = err
+	m.mu.Unlock()
+
+	return err
+}
+
+// CheckConsumer fails when the consumer loop has stopped, or has made no
+// progress for the stall timeout: it hangs on a fetch, or keeps retrying a
+// message while a dependency is down.
+func (m *MessagingService) CheckConsumer(ctx context.Context) error {
+	m.mu.Lock()
+	stopped, consumerErr := m.stopped, m.consumerErr
+	m.mu.Unlock()
+
+	if stopped {
+		if consumerErr != nil {
+			return fmt.Errorf("consumer stopped: %w", consumerErr)
+		}
+		return ErrConsumerStopped
+	}
+
+	last := m.broker.LastProgress()
+	if last.IsZero() {
+		return ErrConsumerNotStarted
+	}
+	if stalled := time.Since(last); stalled > m.stallTimeout {
+		return fmt.Errorf("consumer has made no progress for %s", stalled.Round(time.Second))
+	}
+	return nil
+}
+
+// CheckBroker fails when the broker cannot be reached.
+func (m *MessagingService) CheckBroker(ctx context.Context) error {
+	return m.broker.Ping(ctx)
+}
+
+func (m *MessagingService) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	replayer, ok := m.broker.(broker.DeadLetterReplayer)
+	if !ok {
+		return 0, broker.ErrReplayNotSupported
+	}
+	return replayer.ReplayDeadLetters(ctx, limit)
+}
+
+// processMessage continues the trace and the request ID of
+// PublishNotification, if the message carries them.
+func (m *MessagingService) processMessage(ctx context.Context, msg *broker.Message) (err error) {
+	ctx = logging.WithRequestID(ctx, msg.Headers[headerRequestID])
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, msg.Headers), "MessagingService.Process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("user", msg.Key)),
+	)
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
+	var notif models.Notification
+	if err := json.Unmarshal(msg.Value, &notif); err != nil {
+		return broker.Permanent(err)
+	}
+
+	if notif.Receiver == "" {
+		return broker.Permanent(errors.New("notification has no receiver"))
+	}
+	ctx = logging.With(ctx, "notification_id", notif.ID.Hex())
+
+	if notif.Expired(time.Now()) {
+		slog.InfoContext(ctx, "dropping expired notification")
+		return nil
+	}
+
+	err = m.notifSvc.CreateNotification(ctx, &notif)
+	if err == customerrors.ErrDuplicateNotif {
+		slog.InfoContext(ctx, "skipping duplicate notification")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.hub.SendToUser(ctx, notif.Receiver, notif)
+	m.notifSvc.SendBadge(ctx, notif.Receiver)
+	return nil
+}
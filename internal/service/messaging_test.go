@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/taekwondodev/push-notification-service/internal/broker"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+// stubBroker reports a fixed consumer progress.
+type stubBroker struct {
+	broker.Broker
+	lastProgress time.Time
+}
+
+func (b *stubBroker) LastProgress() time.Time {
+	return b.lastProgress
+}
+
+func TestCheckConsumer(t *testing.T) {
+	now := time.Now()
+	stopErr := errors.New("group coordinator unavailable")
+
+	tests := []struct {
+		name         string
+		lastProgress time.Time
+		stopped      bool
+		consumerErr  error
+		wantErr      bool
+	}{
+		{name: "recent progress", lastProgress: now.Add(-5 * time.Second)},
+		{name: "not started", wantErr: true},
+		{name: "stalled", lastProgress: now.Add(-2 * time.Minute), wantErr: true},
+		{name: "stopped", lastProgress: now, stopped: true, wantErr: true},
+		{name: "stopped with error", lastProgress: now, stopped: true, consumerErr: stopErr, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMessagingService(&stubBroker{lastProgress: tt.lastProgress}, nil, nil, &config.BrokerConfig{StallTimeout: time.Minute})
+			m.stopped = tt.stopped
+			m.consumerErr = tt.consumerErr
+
+			err := m.CheckConsumer(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckConsumer() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.consumerErr != nil && !errors.Is(err, tt.consumerErr) {
+				t.Errorf("CheckConsumer() = %v, want it to wrap %v", err, tt.consumerErr)
+			}
+		})
+	}
+}
+
+func TestNewMessagingServiceStallTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second, broker.FetchIdleTimeout} {
+		m := NewMessagingService(&stubBroker{}, nil, nil, &config.BrokerConfig{StallTimeout: timeout})
+		if m.stallTimeout != defaultStallTimeout {
+			t.Errorf("stall timeout %v gave %v, want %v", timeout, m.stallTimeout, defaultStallTimeout)
+		}
+	}
+}
@@ -2,26 +2,42 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 
+	"github.com/taekwondodev/push-notification-service/internal/customerrors"
 	"github.com/taekwondodev/push-notification-service/internal/models"
 	"github.com/taekwondodev/push-notification-service/internal/repository"
+	"github.com/taekwondodev/push-notification-service/internal/websocket"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type NotificationServiceInterface interface {
 	CreateNotification(ctx context.Context, notification *models.Notification) error
-	GetNotificationsByReceiver(ctx context.Context, receiver string, unreadOnly bool) ([]models.Notification, error)
-	MarkAsRead(ctx context.Context, id string) error
-	GetNotificationByID(ctx context.Context, id string) (*models.Notification, error)
+	GetNotificationsByReceiver(ctx context.Context, receiver string, query *models.NotificationQuery) (*models.NotificationPage, error)
+	MarkAsRead(ctx context.Context, receiver, id string) error
+	GetNotificationByID(ctx context.Context, receiver, id string) (*models.Notification, error)
+	MarkManyAsRead(ctx context.Context, receiver string, ids []string) (int64, error)
+	MarkAllAsRead(ctx context.Context, receiver string, scope *models.MarkAllReadRequest) (int64, error)
+	SetArchived(ctx context.Context, receiver, id string, archived bool) error
+	SetManyArchived(ctx context.Context, receiver string, ids []string, archived bool) (int64, error)
+	DeleteNotification(ctx context.Context, receiver, id string) error
+	DeleteNotifications(ctx context.Context, receiver string, ids []string) (int64, error)
+	CountUnread(ctx context.Context, receiver string) (int64, error)
+	FindMissed(ctx context.Context, receiver, lastSeen string, limit int) ([]models.Notification, bool, error)
+	MarkDelivered(ctx context.Context, receiver string, ids []string) (int64, error)
+	SendBadge(ctx context.Context, receiver string)
 }
 
 type NotificationService struct {
 	repo repository.NotificationRepository
+	hub  *websocket.Hub
 }
 
-func NewNotificationService(repo repository.NotificationRepository) *NotificationService {
+func NewNotificationService(repo repository.NotificationRepository, hub *websocket.Hub) *NotificationService {
 	return &NotificationService{
 		repo: repo,
+		hub:  hub,
 	}
 }
 
@@ -37,19 +53,160 @@ func (s *NotificationService) CreateNotification(ctx context.Context, notificati
 	return nil
 }
 
-func (s *NotificationService) GetNotificationsByReceiver(ctx context.Context, receiver string, unread bool) ([]models.Notification, error) {
-	notifications, err := s.repo.FindByReceiver(ctx, receiver, unread)
+func (s *NotificationService) GetNotificationsByReceiver(ctx context.Context, receiver string, query *models.NotificationQuery) (*models.NotificationPage, error) {
+	page, err := s.repo.FindByReceiver(ctx, receiver, query)
 	if err != nil {
 		return nil, err
 	}
 
-	return notifications, nil
+	return page, nil
 }
 
-func (s *NotificationService) MarkAsRead(ctx context.Context, id string) error {
-	if err := s.repo.MarkAsRead(ctx, id); err != nil {
+func (s *NotificationService) GetNotificationByID(ctx context.Context, receiver, id string) (*models.Notification, error) {
+	notification, err := s.repo.FindByID(ctx, receiver, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+func (s *NotificationService) MarkAsRead(ctx context.Context, receiver, id string) error {
+	if err := s.repo.MarkAsRead(ctx, receiver, id); err != nil {
+		return err
+	}
+
+	s.notifyChange(ctx, receiver, websocket.EventRead, models.ReadStateChange{IDs: []string{id}, Read: true})
+	return nil
+}
+
+func (s *NotificationService) MarkManyAsRead(ctx context.Context, receiver string, ids []string) (int64, error) {
+	modified, err := s.repo.MarkManyAsRead(ctx, receiver, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if modified > 0 {
+		s.notifyChange(ctx, receiver, websocket.EventRead, models.ReadStateChange{IDs: ids, Read: true})
+	}
+	return modified, nil
+}
+
+func (s *NotificationService) MarkAllAsRead(ctx context.Context, receiver string, scope *models.MarkAllReadRequest) (int64, error) {
+	modified, err := s.repo.MarkAllAsRead(ctx, receiver, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	if modified > 0 {
+		s.notifyChange(ctx, receiver, websocket.EventRead, models.ReadStateChange{
+			All:    true,
+			Before: scope.Before,
+			Sender: scope.Sender,
+			Read:   true,
+		})
+	}
+	return modified, nil
+}
+
+func (s *NotificationService) SetArchived(ctx context.Context, receiver, id string, archived bool) error {
+	if err := s.repo.SetArchived(ctx, receiver, id, archived); err != nil {
+		return err
+	}
+
+	s.notifyChange(ctx, receiver, websocket.EventArchived, models.ArchiveStateChange{IDs: []string{id}, Archived: archived})
+	return nil
+}
+
+func (s *NotificationService) SetManyArchived(ctx context.Context, receiver string, ids []string, archived bool) (int64, error) {
+	modified, err := s.repo.SetManyArchived(ctx, receiver, ids, archived)
+	if err != nil {
+		return 0, err
+	}
+
+	if modified > 0 {
+		s.notifyChange(ctx, receiver, websocket.EventArchived, models.ArchiveStateChange{IDs: ids, Archived: archived})
+	}
+	return modified, nil
+}
+
+func (s *NotificationService) DeleteNotification(ctx context.Context, receiver, id string) error {
+	if err := s.repo.Delete(ctx, receiver, id); err != nil {
 		return err
 	}
 
+	s.notifyChange(ctx, receiver, websocket.EventDeleted, models.DeletedChange{IDs: []string{id}})
 	return nil
 }
+
+func (s *NotificationService) DeleteNotifications(ctx context.Context, receiver string, ids []string) (int64, error) {
+	deleted, err := s.repo.DeleteMany(ctx, receiver, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if deleted > 0 {
+		s.notifyChange(ctx, receiver, websocket.EventDeleted, models.DeletedChange{IDs: ids})
+	}
+	return deleted, nil
+}
+
+func (s *NotificationService) CountUnread(ctx context.Context, receiver string) (int64, error) {
+	return s.repo.CountUnread(ctx, receiver)
+}
+
+// FindMissed returns up to limit notifications created after lastSeen, oldest
+// first, and whether that covers all of them. A lastSeen that no longer
+// exists, because it expired or was deleted, is located by the creation time
+// embedded in its ObjectID.
+func (s *NotificationService) FindMissed(ctx context.Context, receiver, lastSeen string, limit int) ([]models.Notification, bool, error) {
+	objID, err := primitive.ObjectIDFromHex(lastSeen)
+	if err != nil {
+		return nil, false, customerrors.ErrBadRequest
+	}
+
+	after := &models.Cursor{CreatedAt: objID.Timestamp().Unix(), ID: objID}
+	notification, err := s.repo.FindByID(ctx, receiver, lastSeen)
+	switch {
+	case err == nil:
+		after = models.CursorFor(notification)
+	case !errors.Is(err, customerrors.ErrNotificationNotFound):
+		return nil, false, err
+	}
+
+	notifications, err := s.repo.FindAfter(ctx, receiver, after, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(notifications) > limit {
+		return notifications[:limit], false, nil
+	}
+	return notifications, true, nil
+}
+
+func (s *NotificationService) MarkDelivered(ctx context.Context, receiver string, ids []string) (int64, error) {
+	return s.repo.MarkDelivered(ctx, receiver, ids)
+}
+
+// SendBadge pushes the current unread count so that every open client of
+// the user shows the same badge.
+func (s *NotificationService) SendBadge(ctx context.Context, receiver string) {
+	count, err := s.repo.CountUnread(ctx, receiver)
+	if err != nil {
+		slog.ErrorContext(ctx, "error counting unread notifications", "error", err)
+		return
+	}
+
+	s.hub.SendEventToUser(ctx, receiver, websocket.Event{
+		Type:    websocket.EventBadge,
+		Payload: models.UnreadCount{Count: count},
+	})
+}
+
+// notifyChange reflects a state change to the user's connected devices and
+// refreshes their badge, since every change may affect the unread count.
+func (s *NotificationService) notifyChange(ctx context.Context, receiver, eventType string, payload any) {
+	s.hub.SendEventToUser(ctx, receiver, websocket.Event{Type: eventType, Payload: payload})
+	s.SendBadge(ctx, receiver)
+}
@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
+	"github.com/taekwondodev/push-notification-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type OverflowPolicy string
+
+const (
+	DropOldest OverflowPolicy = "drop-oldest"
+	DropNewest OverflowPolicy = "drop-newest"
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+type Client struct {
+	ID   string
+	User string
+
+	log          *slog.Logger
+	sink         Sink
+	send         chan Frame
+	done         chan struct{}
+	stopped      chan struct{}
+	closeOnce    sync.Once
+	closeCode    int
+	closeText    string
+	writeTimeout time.Duration
+	pingInterval time.Duration
+
+	// While held, live messages wait in pending so that a replay of missed
+	// notifications can go out first. events is nil until the client
+	// subscribes to a subset of the events.
+	mu      sync.Mutex
+	held    bool
+	pending []Frame
+	events  map[string]bool
+}
+
+func newClient(user string, sink Sink, bufferSize int, writeTimeout, pingInterval time.Duration) *Client {
+	id := newConnectionID()
+	return &Client{
+		ID:           id,
+		User:         user,
+		log:          slog.With("user", user, "conn", id),
+		sink:         sink,
+		send:         make(chan Frame, bufferSize),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+		writeTimeout: writeTimeout,
+		pingInterval: pingInterval,
+	}
+}
+
+// Done is closed once the client has been asked to shut down.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stopped is closed once the client has stopped writing to its sink and
+// closed it. Sinks tied to an HTTP handler must not return before.
+func (c *Client) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+func (c *Client) Close() {
+	c.closeWithCode(websocket.CloseNormalClosure, "")
+}
+
+func (c *Client) closeWithCode(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
+
+// Subscribe restricts the subscribable events sent to the client to the
+// given ones.
+func (c *Client) Subscribe(events []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.events = make(map[string]bool, len(events))
+	for _, event := range events {
+		c.events[event] = true
+	}
+}
+
+func (c *Client) wants(event string) bool {
+	return c.events == nil || !IsSubscribable(event) || c.events[event]
+}
+
+// push delivers a live message, or keeps it for later while the client is
+// held. Pending messages are bounded by the send buffer size, but at least
+// the latest one is always kept.
+func (c *Client) push(msg Frame, policy OverflowPolicy) {
+	c.mu.Lock()
+	if !c.wants(msg.Event) {
+		c.mu.Unlock()
+		return
+	}
+	if c.held {
+		if len(c.pending) > 0 && len(c.pending) >= cap(c.send) {
+			c.log.Warn("too many messages during replay, dropping oldest")
+			metrics.MessagesDropped.WithLabelValues("replay_backlog").Inc()
+			c.pending = c.pending[1:]
+		}
+		c.pending = append(c.pending, msg)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.enqueue(msg, policy)
+}
+
+// resume sends the replay, then the live messages held meanwhile, skipping
+// those the replay already carried. It waits for room in the buffer rather
+// than dropping, and only takes the lock to swap out what is pending, so
+// deliveries to the client never wait on its socket.
+func (c *Client) resume(replay []Frame) {
+	sent := make(map[string]struct{}, len(replay))
+	if !c.sendAll(replay, sent) {
+		return
+	}
+
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			c.held = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		if !c.sendAll(pending, sent) {
+			return
+		}
+	}
+}
+
+func (c *Client) sendAll(messages []Frame, sent map[string]struct{}) bool {
+	for _, msg := range messages {
+		if _, ok := sent[msg.ID]; ok {
+			continue
+		}
+		c.mu.Lock()
+		wanted := c.wants(msg.Event)
+		c.mu.Unlock()
+		if !wanted {
+			continue
+		}
+		select {
+		case c.send <- msg:
+			if msg.ID != "" {
+				sent[msg.ID] = struct{}{}
+			}
+		case <-c.done:
+			return false
+		}
+	}
+	return true
+}
+
+// enqueue never blocks: when the buffer is full the overflow policy decides
+// which message is lost, or whether the connection is dropped altogether.
+func (c *Client) enqueue(msg Frame, policy OverflowPolicy) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+	}
+
+	switch policy {
+	case DropNewest:
+		c.log.Warn("send buffer full, dropping new message")
+		metrics.MessagesDropped.WithLabelValues("buffer_full").Inc()
+		return false
+	case Disconnect:
+		c.log.Warn("send buffer full, disconnecting slow consumer")
+		metrics.MessagesDropped.WithLabelValues("slow_consumer").Inc()
+		c.closeWithCode(websocket.ClosePolicyViolation, "slow consumer")
+		return false
+	default:
+		select {
+		case <-c.send:
+			c.log.Warn("send buffer full, dropping oldest message")
+			metrics.MessagesDropped.WithLabelValues("buffer_full").Inc()
+		default:
+		}
+		select {
+		case c.send <- msg:
+			return true
+		default:
+			metrics.MessagesDropped.WithLabelValues("buffer_full").Inc()
+			return false
+		}
+	}
+}
+
+// writePump is the only goroutine allowed to write to the sink.
+func (c *Client) writePump() {
+	pingTicker := time.NewTicker(c.pingInterval)
+	defer func() {
+		pingTicker.Stop()
+		close(c.stopped)
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.closeSink()
+			return
+		case msg := <-c.send:
+			if err := c.write(msg); err != nil {
+				c.log.Warn("error sending message", "error", err)
+				metrics.MessagesFailed.Inc()
+				c.Close()
+				c.closeSink()
+				return
+			}
+			metrics.MessagesSent.Inc()
+		case <-pingTicker.C:
+			if err := c.sink.Ping(time.Now().Add(c.writeTimeout)); err != nil {
+				c.Close()
+				c.closeSink()
+				return
+			}
+		}
+	}
+}
+
+// write sends a frame to the sink, in a span under the push that produced it
+// when there is one.
+func (c *Client) write(msg Frame) error {
+	if !msg.span.IsValid() {
+		return c.sink.Write(msg, time.Now().Add(c.writeTimeout))
+	}
+
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), msg.span)
+	_, span := tracing.Tracer().Start(ctx, "Client.Write", trace.WithAttributes(
+		attribute.String("user", c.User),
+		attribute.String("connection.id", c.ID),
+		attribute.String("event", msg.Event),
+	))
+	defer span.End()
+
+	err := c.sink.Write(msg, time.Now().Add(c.writeTimeout))
+	tracing.Fail(span, err)
+	return err
+}
+
+func (c *Client) closeSink() {
+	c.sink.Close(c.closeCode, c.closeText, time.Now().Add(c.writeTimeout))
+}
+
+func newConnectionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
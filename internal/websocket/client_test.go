@@ -0,0 +1,271 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func frame(id string) Frame {
+	return Frame{ID: id, Event: EventNotification, Data: []byte(id)}
+}
+
+// queued drains what is waiting in the client's send buffer.
+func queued(c *Client) []string {
+	var ids []string
+	for {
+		select {
+		case msg := <-c.send:
+			ids = append(ids, msg.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func ids(frames []Frame) []string {
+	ids := make([]string, 0, len(frames))
+	for _, f := range frames {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func TestClientOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy     OverflowPolicy
+		want       []string
+		disconnect bool
+	}{
+		{DropOldest, []string{"2", "3"}, false},
+		{DropNewest, []string{"1", "2"}, false},
+		{Disconnect, []string{"1", "2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			// Without a write pump the buffer of two fills up for good.
+			client := newClient("alice", &fakeSink{}, 2, time.Second, time.Hour)
+
+			for _, id := range []string{"1", "2", "3"} {
+				client.push(frame(id), tt.policy)
+			}
+
+			select {
+			case <-client.Done():
+				if !tt.disconnect {
+					t.Fatal("client disconnected")
+				}
+				if client.closeCode != websocket.ClosePolicyViolation {
+					t.Errorf("close code = %d, want %d", client.closeCode, websocket.ClosePolicyViolation)
+				}
+			default:
+				if tt.disconnect {
+					t.Fatal("slow client was not disconnected")
+				}
+			}
+
+			if got := queued(client); !slices.Equal(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientEnqueueAfterClose(t *testing.T) {
+	client := newClient("alice", &fakeSink{}, 2, time.Second, time.Hour)
+	client.Close()
+
+	if client.enqueue(frame("1"), DropOldest) {
+		t.Error("enqueue accepted a message for a closed client")
+	}
+	if got := queued(client); len(got) != 0 {
+		t.Errorf("queued %v after close", got)
+	}
+}
+
+func TestClientWritePump(t *testing.T) {
+	sink := &fakeSink{}
+	client := newClient("alice", sink, 4, time.Second, time.Hour)
+	go client.writePump()
+
+	for _, id := range []string{"1", "2", "3"} {
+		client.push(frame(id), DropOldest)
+	}
+	eventually(t, "the frames to be written", func() bool { return len(sink.written()) == 3 })
+
+	client.Close()
+	stopped(t, client)
+
+	if got, want := ids(sink.written()), []string{"1", "2", "3"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %v, want %v", got, want)
+	}
+	if closed, code := sink.closedWith(); !closed || code != websocket.CloseNormalClosure {
+		t.Errorf("sink closed = %v with code %d", closed, code)
+	}
+}
+
+// A stalled socket holds up its own pump only: pushes to it return at once
+// and other clients keep receiving.
+func TestClientStalledSinkDoesNotBlockOthers(t *testing.T) {
+	hub := newTestHub(1, DropNewest)
+
+	stalled := &fakeSink{gate: make(chan struct{})}
+	healthy := &fakeSink{}
+	stalledClient := hub.Register("alice", stalled)
+	hub.Register("alice", healthy)
+
+	pushed := make(chan struct{})
+	go func() {
+		for i := range 10 {
+			hub.SendEventToUser(context.Background(), "alice", badge(i))
+		}
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushes blocked on a stalled connection")
+	}
+	eventually(t, "the healthy connection to get a frame", func() bool { return len(healthy.written()) > 0 })
+
+	close(stalled.gate)
+	hub.Unregister(stalledClient)
+	stopped(t, stalledClient)
+}
+
+func TestHubShutdownWaitsForWritePumps(t *testing.T) {
+	hub := newTestHub(4, DropOldest)
+
+	stalled := &fakeSink{gate: make(chan struct{})}
+	idle := &fakeSink{}
+	stalledClient := hub.Register("alice", stalled)
+	idleClient := hub.Register("bob", idle)
+
+	hub.SendEventToUser(context.Background(), "alice", badge(1))
+	// Wait until the pump has taken the frame and is stuck writing it.
+	eventually(t, "the stalled pump to take the frame", func() bool { return len(stalledClient.send) == 0 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := hub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a stalled pump = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	stopped(t, idleClient)
+	if closed, code := idle.closedWith(); !closed || code != websocket.CloseServiceRestart {
+		t.Errorf("idle sink closed = %v with code %d, want %d", closed, code, websocket.CloseServiceRestart)
+	}
+
+	close(stalled.gate)
+	if err := hub.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	if closed, code := stalled.closedWith(); !closed || code != websocket.CloseServiceRestart {
+		t.Errorf("stalled sink closed = %v with code %d, want %d", closed, code, websocket.CloseServiceRestart)
+	}
+
+	// A client connecting after the hub closed is turned away.
+	late := &fakeSink{}
+	lateClient := hub.Register("carol", late)
+	stopped(t, lateClient)
+	if closed, code := late.closedWith(); !closed || code != websocket.CloseServiceRestart {
+		t.Errorf("late sink closed = %v with code %d, want %d", closed, code, websocket.CloseServiceRestart)
+	}
+	if clients := hub.clientsOf("carol"); len(clients) != 0 {
+		t.Error("hub registered a client after closing")
+	}
+}
+
+func TestClientResumeSendsReplayThenHeld(t *testing.T) {
+	// A buffer of two makes the replay wait for the pump rather than drop.
+	sink := &fakeSink{}
+	client := newClient("alice", sink, 2, time.Second, time.Hour)
+	client.held = true
+	go client.writePump()
+	defer client.Close()
+
+	// Live pushes while the replay is loading, one of them also replayed.
+	client.push(frame("2"), DropOldest)
+	client.push(frame("3"), DropOldest)
+
+	resumed := Frame{Event: EventResumed}
+	client.resume([]Frame{frame("1"), frame("2"), resumed})
+	eventually(t, "the replay and held frames to be written", func() bool { return len(sink.written()) == 4 })
+
+	client.push(frame("4"), DropOldest)
+	eventually(t, "every frame to be written", func() bool { return len(sink.written()) == 5 })
+
+	if got, want := ids(sink.written()), []string{"1", "2", "", "3", "4"}; !slices.Equal(got, want) {
+		t.Errorf("wrote %v, want %v", got, want)
+	}
+}
+
+func TestClientHeldBacklogIsBounded(t *testing.T) {
+	client := newClient("alice", &fakeSink{}, 2, time.Second, time.Hour)
+	client.held = true
+
+	for _, id := range []string{"1", "2", "3"} {
+		client.push(frame(id), DropOldest)
+	}
+	if got, want := ids(client.pending), []string{"2", "3"}; !slices.Equal(got, want) {
+		t.Errorf("pending %v, want %v", got, want)
+	}
+	if got := queued(client); len(got) != 0 {
+		t.Errorf("held client was sent %v", got)
+	}
+}
+
+// Messages pushed while a resume is in progress are neither lost nor sent
+// twice, whether they land in pending or go out live.
+func TestClientPushDuringResume(t *testing.T) {
+	const replayed, live = 50, 50
+
+	hub := newTestHub(replayed+live, DropNewest)
+	sink := &fakeSink{}
+	client := hub.RegisterHeld("alice", sink)
+	defer hub.Unregister(client)
+
+	replay := make([]Frame, 0, replayed)
+	for i := range replayed {
+		replay = append(replay, frame(fmt.Sprintf("r%d", i)))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range live {
+			client.push(frame(fmt.Sprintf("l%d", i)), hub.policy)
+		}
+	}()
+	client.resume(replay)
+	<-done
+
+	eventually(t, "every frame to be written", func() bool { return len(sink.written()) == replayed+live })
+
+	seen := make(map[string]int)
+	for _, id := range ids(sink.written()) {
+		seen[id]++
+	}
+	for _, f := range replay {
+		if seen[f.ID] != 1 {
+			t.Errorf("replayed %s written %d times", f.ID, seen[f.ID])
+		}
+	}
+	for i := range live {
+		if id := fmt.Sprintf("l%d", i); seen[id] != 1 {
+			t.Errorf("live %s written %d times", id, seen[id])
+		}
+	}
+
+	written := ids(sink.written())
+	if !slices.Equal(written[:replayed], ids(replay)) {
+		t.Error("live messages overtook the replay")
+	}
+}
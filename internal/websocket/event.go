@@ -0,0 +1,60 @@
+package websocket
+
+import "encoding/json"
+
+// ProtocolVersion is carried in every envelope as "v". Clients may omit it
+// in commands, which then default to the current version.
+const ProtocolVersion = 1
+
+// Server events.
+const (
+	EventNotification = "notification"
+	EventRead         = "read"
+	EventBadge        = "badge"
+	EventArchived     = "archived"
+	EventDeleted      = "deleted"
+	EventResumed      = "resumed"
+	EventResult       = "result"
+	EventError        = "error"
+)
+
+// Client commands.
+const (
+	CommandAck       = "ack"
+	CommandMarkRead  = "markRead"
+	CommandSubscribe = "subscribe"
+	CommandPing      = "ping"
+)
+
+// subscribable lists the events a client may opt in or out of with a
+// subscribe command. The others are part of the protocol and always sent.
+var subscribable = map[string]bool{
+	EventNotification: true,
+	EventRead:         true,
+	EventBadge:        true,
+	EventArchived:     true,
+	EventDeleted:      true,
+}
+
+func IsSubscribable(eventType string) bool {
+	return subscribable[eventType]
+}
+
+// Event is the envelope of every message the server sends. ID is the
+// notification ID for notification events and echoes the command ID for
+// results and errors.
+type Event struct {
+	V       int    `json:"v"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Payload any    `json:"payload"`
+}
+
+// Command is the envelope of every message a client sends. Its payload is
+// decoded once the type is known.
+type Command struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
@@ -1,55 +1,367 @@
 package websocket
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/taekwondodev/push-notification-service/internal/broker"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+	"github.com/taekwondodev/push-notification-service/internal/metrics"
 	"github.com/taekwondodev/push-notification-service/internal/models"
+	"github.com/taekwondodev/push-notification-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Subprotocol is echoed back to clients that authenticate with a ticket
+// subprotocol, since browsers reject an upgrade that selects none.
+const Subprotocol = "notifications"
+
+const restartText = "service restarting"
+
+const (
+	defaultSendBufferSize = 64
+	defaultWriteTimeout   = 10 * time.Second
+	defaultPingInterval   = 30 * time.Second
+)
+
+const (
+	// headerOrigin marks the instance that broadcast a push, which has
+	// already delivered it to its own clients.
+	headerOrigin         = "x-origin"
+	headerNotificationID = "x-notification-id"
+	headerEventType      = "x-event-type"
 )
 
 type Hub struct {
 	Upgrader websocket.Upgrader
-	clients  map[string]*websocket.Conn
-	mu       sync.Mutex
+	clients  map[string]map[string]*Client
+	mu       sync.RWMutex
+	cfg      *config.WebSocketConfig
+	policy   OverflowPolicy
+
+	// Once closed, the hub turns every new client away. pumps counts the
+	// write pumps of registered clients, for Shutdown to wait on.
+	closed bool
+	pumps  sync.WaitGroup
+
+	// fanout carries pushes to the other instances, which may hold sockets
+	// of the same user.
+	fanout     broker.Fanout
+	instanceID string
 }
 
-func NewHub() *Hub {
+func NewHub(cfg *config.WebSocketConfig) *Hub {
 	var up = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin:  func(r *http.Request) bool { return true },
+		Subprotocols: []string{Subprotocol},
 	}
+
+	policy := OverflowPolicy(cfg.OverflowPolicy)
+	switch policy {
+	case DropOldest, DropNewest, Disconnect:
+	default:
+		slog.Warn("unknown overflow policy, using the default", "policy", cfg.OverflowPolicy, "default", DropOldest)
+		policy = DropOldest
+	}
+
+	// Out-of-range values would make every connection panic, so they fall
+	// back to the defaults as well.
+	settings := *cfg
+	if settings.SendBufferSize < 1 {
+		slog.Warn("invalid send buffer size, using the default", "size", cfg.SendBufferSize, "default", defaultSendBufferSize)
+		settings.SendBufferSize = defaultSendBufferSize
+	}
+	if settings.WriteTimeout <= 0 {
+		slog.Warn("invalid write timeout, using the default", "timeout", cfg.WriteTimeout, "default", defaultWriteTimeout)
+		settings.WriteTimeout = defaultWriteTimeout
+	}
+	if settings.PingInterval <= 0 {
+		slog.Warn("invalid ping interval, using the default", "interval", cfg.PingInterval, "default", defaultPingInterval)
+		settings.PingInterval = defaultPingInterval
+	}
+
 	return &Hub{
 		Upgrader: up,
-		clients:  make(map[string]*websocket.Conn),
+		clients:  make(map[string]map[string]*Client),
+		cfg:      &settings,
+		policy:   policy,
+	}
+}
+
+// ReadTimeout is how long a connection may stay silent before it is
+// considered dead. Every ping should be answered within it, so it spans two
+// ping intervals.
+func (h *Hub) ReadTimeout() time.Duration {
+	return 2 * h.cfg.PingInterval
+}
+
+// UseFanout makes every push reach the user's clients on all instances. It
+// must be called before the hub is used.
+func (h *Hub) UseFanout(fanout broker.Fanout, instanceID string) {
+	h.fanout = fanout
+	h.instanceID = instanceID
+}
+
+// ListenFanout delivers pushes broadcast by other instances to the clients
+// connected here, until ctx is cancelled.
+func (h *Hub) ListenFanout(ctx context.Context) error {
+	return h.fanout.Listen(ctx, func(ctx context.Context, msg *broker.Message) error {
+		if msg.Headers[headerOrigin] == h.instanceID {
+			return nil
+		}
+		h.deliver(msg.Key, Frame{
+			ID:    msg.Headers[headerNotificationID],
+			Event: msg.Headers[headerEventType],
+			Data:  msg.Value,
+			span:  trace.SpanContextFromContext(tracing.Extract(ctx, msg.Headers)),
+		})
+		return nil
+	})
+}
+
+// Register attaches a connection of any transport to the user. Everything
+// sent to the user from then on is written to its sink.
+func (h *Hub) Register(user string, sink Sink) *Client {
+	return h.register(user, sink, false)
+}
+
+// RegisterHeld registers a client that is about to catch up on missed
+// notifications. Live messages are held back until Resume is called.
+func (h *Hub) RegisterHeld(user string, sink Sink) *Client {
+	return h.register(user, sink, true)
+}
+
+// Resume replays notifications to a held client, then tells it whether the
+// replay was complete and switches it to live delivery.
+func (h *Hub) Resume(client *Client, notifications []models.Notification, complete bool) {
+	now := time.Now()
+	replay := make([]Frame, 0, len(notifications)+1)
+	for _, notification := range notifications {
+		if notification.Expired(now) {
+			continue
+		}
+		msg, err := encode(notificationEvent(notification))
+		if err != nil {
+			client.log.Error("error encoding notification", "notification_id", notification.ID.Hex(), "error", err)
+			metrics.MessagesFailed.Inc()
+			continue
+		}
+		replay = append(replay, msg)
 	}
+
+	msg, err := encode(Event{
+		Type:    EventResumed,
+		Payload: models.ResumeResult{Replayed: len(replay), Complete: complete},
+	})
+	if err == nil {
+		replay = append(replay, msg)
+	}
+
+	client.resume(replay)
 }
 
-func (h *Hub) Register(user string, conn *websocket.Conn) {
+func (h *Hub) register(user string, sink Sink, held bool) *Client {
+	client := newClient(user, sink, h.cfg.SendBufferSize, h.cfg.WriteTimeout, h.cfg.PingInterval)
+	client.held = held
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.clients[user] = conn
-	log.Printf("[%s] connected\n", user)
+	if h.closed {
+		h.mu.Unlock()
+		client.closeWithCode(websocket.CloseServiceRestart, restartText)
+		go client.writePump()
+		return client
+	}
+	if _, ok := h.clients[user]; !ok {
+		h.clients[user] = make(map[string]*Client)
+	}
+	h.clients[user][client.ID] = client
+	active := len(h.clients[user])
+	metrics.ConnectedUsers.Set(float64(len(h.clients)))
+	h.pumps.Add(1)
+	h.mu.Unlock()
+
+	metrics.Connections.Inc()
+
+	go func() {
+		defer h.pumps.Done()
+		client.writePump()
+	}()
+
+	client.log.Info("connected", "active", active)
+	return client
 }
 
-func (h *Hub) Unregister(user string) {
+// Close disconnects every client with the "service restart" close code,
+// which tells them to reconnect, to another instance if need be. Clients
+// registering from then on are disconnected right away.
+func (h *Hub) Close() {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	clients := make([]*Client, 0, len(h.clients))
+	for _, conns := range h.clients {
+		for _, client := range conns {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.Unlock()
 
-	if conn, ok := h.clients[user]; ok {
-		conn.Close()
-		delete(h.clients, user)
-		log.Printf("[%s] disconnected\n", user)
+	for _, client := range clients {
+		client.closeWithCode(websocket.CloseServiceRestart, restartText)
 	}
+	slog.Info("closed all connections", "count", len(clients))
 }
 
-func (h *Hub) SendToUser(user string, message models.Notification) {
+// Shutdown closes the hub, then waits until every client has written its
+// close frame or ctx is done.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.Close()
+
+	stopped := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) Unregister(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if conn, ok := h.clients[user]; ok {
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("error sending message to user %s: %v", user, err)
+	conns, ok := h.clients[client.User]
+	if !ok {
+		return
+	}
+
+	if _, ok := conns[client.ID]; ok {
+		client.Close()
+		delete(conns, client.ID)
+		if len(conns) == 0 {
+			delete(h.clients, client.User)
 		}
+		metrics.Connections.Dec()
+		metrics.ConnectedUsers.Set(float64(len(h.clients)))
+		client.log.Info("disconnected", "active", len(conns))
+	}
+}
+
+func (h *Hub) SendToUser(ctx context.Context, user string, message models.Notification) {
+	ctx, span := tracing.Tracer().Start(ctx, "Hub.SendToUser", trace.WithAttributes(
+		attribute.String("user", user),
+		attribute.String("notification.id", message.ID.Hex()),
+	))
+	defer span.End()
+
+	if message.Expired(time.Now()) {
+		slog.InfoContext(ctx, "dropping expired notification")
+		metrics.MessagesDropped.WithLabelValues("expired").Inc()
+		span.AddEvent("expired")
+		return
+	}
+	h.SendEventToUser(ctx, user, notificationEvent(message))
+}
+
+// SendEventToUser pushes an event to every connection of the user, here and
+// on the other instances. The trace in ctx follows the event to the writes.
+func (h *Hub) SendEventToUser(ctx context.Context, user string, event Event) {
+	msg, err := encode(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "error encoding message", "event", event.Type, "error", err)
+		metrics.MessagesFailed.Inc()
+		return
+	}
+	msg.span = trace.SpanContextFromContext(ctx)
+
+	h.deliver(user, msg)
+
+	if h.fanout == nil {
+		return
+	}
+	headers := map[string]string{
+		headerOrigin:    h.instanceID,
+		headerEventType: msg.Event,
+	}
+	if msg.ID != "" {
+		headers[headerNotificationID] = msg.ID
+	}
+	tracing.Inject(ctx, headers)
+	err = h.fanout.Broadcast(context.WithoutCancel(ctx), &broker.Message{
+		Key:     user,
+		Value:   msg.Data,
+		Headers: headers,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error broadcasting message", "event", msg.Event, "error", err)
+	}
+}
+
+// Reply sends an event to a single connection, such as the response to one
+// of its commands.
+func (h *Hub) Reply(client *Client, event Event) {
+	msg, err := encode(event)
+	if err != nil {
+		client.log.Error("error encoding reply", "event", event.Type, "error", err)
+		metrics.MessagesFailed.Inc()
+		return
+	}
+	client.push(msg, h.policy)
+}
+
+func (h *Hub) deliver(user string, msg Frame) {
+	for _, client := range h.clientsOf(user) {
+		client.push(msg, h.policy)
+	}
+}
+
+// clientsOf returns a snapshot so that enqueueing never happens under h.mu.
+func (h *Hub) clientsOf(user string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients[user]))
+	for _, client := range h.clients[user] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func notificationEvent(notification models.Notification) Event {
+	return Event{
+		Type:    EventNotification,
+		ID:      notification.ID.Hex(),
+		Payload: notification,
+	}
+}
+
+// encode stamps the protocol version on an event and marshals it once for
+// all of the connections it goes to.
+func encode(event Event) (Frame, error) {
+	event.V = ProtocolVersion
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	msg := Frame{Event: event.Type, Data: data}
+	if event.Type == EventNotification {
+		msg.ID = event.ID
 	}
+	return msg, nil
 }
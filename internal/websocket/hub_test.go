@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/taekwondodev/push-notification-service/internal/config"
+)
+
+// fakeSink records what a client writes. While gate is set, every write
+// waits for it to be closed.
+type fakeSink struct {
+	mu        sync.Mutex
+	frames    []Frame
+	closed    bool
+	closeCode int
+	gate      chan struct{}
+}
+
+func (s *fakeSink) Write(frame Frame, deadline time.Time) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+func (s *fakeSink) Ping(deadline time.Time) error {
+	return nil
+}
+
+func (s *fakeSink) Close(code int, text string, deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.closeCode = code
+	return nil
+}
+
+func (s *fakeSink) written() []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Frame(nil), s.frames...)
+}
+
+func (s *fakeSink) closedWith() (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed, s.closeCode
+}
+
+func newTestHub(bufferSize int, policy OverflowPolicy) *Hub {
+	return NewHub(&config.WebSocketConfig{
+		SendBufferSize: bufferSize,
+		WriteTimeout:   time.Second,
+		PingInterval:   time.Hour,
+		OverflowPolicy: string(policy),
+	})
+}
+
+// eventually polls check until it succeeds or a few seconds have passed.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func stopped(t *testing.T, client *Client) {
+	t.Helper()
+
+	select {
+	case <-client.Stopped():
+	case <-time.After(5 * time.Second):
+		t.Fatal("write pump did not stop")
+	}
+}
+
+func badge(count int) Event {
+	return Event{Type: EventBadge, Payload: map[string]int{"unread": count}}
+}
+
+func TestHubFansOutToEveryConnectionOfTheUser(t *testing.T) {
+	hub := newTestHub(8, DropOldest)
+	ctx := context.Background()
+
+	laptop, phone, other := &fakeSink{}, &fakeSink{}, &fakeSink{}
+	laptopClient := hub.Register("alice", laptop)
+	phoneClient := hub.Register("alice", phone)
+	otherClient := hub.Register("bob", other)
+	defer hub.Unregister(phoneClient)
+	defer hub.Unregister(otherClient)
+
+	if laptopClient.ID == phoneClient.ID {
+		t.Fatal("connections of one user share an ID")
+	}
+
+	hub.SendEventToUser(ctx, "alice", badge(1))
+	eventually(t, "both connections to get the event", func() bool {
+		return len(laptop.written()) == 1 && len(phone.written()) == 1
+	})
+	if got := other.written(); len(got) != 0 {
+		t.Errorf("another user got %d frames", len(got))
+	}
+
+	// Dropping one device leaves the other connected.
+	hub.Unregister(laptopClient)
+	stopped(t, laptopClient)
+	if closed, code := laptop.closedWith(); !closed || code != websocket.CloseNormalClosure {
+		t.Errorf("unregistered sink closed = %v with code %d", closed, code)
+	}
+	if closed, _ := phone.closedWith(); closed {
+		t.Fatal("unregistering one connection closed the other")
+	}
+
+	hub.SendEventToUser(ctx, "alice", badge(2))
+	eventually(t, "the remaining connection to get the event", func() bool {
+		return len(phone.written()) == 2
+	})
+	if got := laptop.written(); len(got) != 1 {
+		t.Errorf("unregistered connection got %d frames, want 1", len(got))
+	}
+
+	hub.mu.RLock()
+	active := len(hub.clients["alice"])
+	hub.mu.RUnlock()
+	if active != 1 {
+		t.Errorf("alice has %d connections, want 1", active)
+	}
+}
+
+func TestHubUnregisterLastConnection(t *testing.T) {
+	hub := newTestHub(8, DropOldest)
+
+	client := hub.Register("alice", &fakeSink{})
+	hub.Unregister(client)
+	// A second unregister, as when both the read loop and the write pump
+	// give up, is a no-op.
+	hub.Unregister(client)
+	stopped(t, client)
+
+	hub.mu.RLock()
+	_, ok := hub.clients["alice"]
+	hub.mu.RUnlock()
+	if ok {
+		t.Error("user without connections is still tracked")
+	}
+	if clients := hub.clientsOf("alice"); len(clients) != 0 {
+		t.Errorf("clientsOf returned %d clients", len(clients))
+	}
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// PollSink collects frames for a long-poll request. It becomes ready with
+// the first frame, or, for a client catching up, once the replay is over and
+// has found something. The resumed event itself is not collected.
+type PollSink struct {
+	mu       sync.Mutex
+	frames   []Frame
+	resuming bool
+	ready    chan struct{}
+}
+
+func NewPollSink(resuming bool) *PollSink {
+	return &PollSink{
+		resuming: resuming,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// Ready receives a value once there is something to return.
+func (s *PollSink) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Frames returns what has been collected. Call it once the client has
+// stopped, so that no write is in flight.
+func (s *PollSink) Frames() []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frames
+}
+
+func (s *PollSink) Write(frame Frame, deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if frame.Event == EventResumed {
+		s.resuming = false
+	} else {
+		s.frames = append(s.frames, frame)
+	}
+
+	if !s.resuming && len(s.frames) > 0 {
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *PollSink) Ping(deadline time.Time) error {
+	return nil
+}
+
+func (s *PollSink) Close(code int, text string, deadline time.Time) error {
+	return nil
+}
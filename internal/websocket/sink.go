@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Frame is an encoded message of the given event type. ID is set for
+// notifications, so that a replay and the live stream can be deduplicated
+// and so that transports can expose it as a resume point. span links the
+// write to the trace of the push that produced the frame.
+type Frame struct {
+	ID    string
+	Event string
+	Data  []byte
+
+	span trace.SpanContext
+}
+
+// Sink is the transport behind a client. Its methods are only called from
+// the client's write pump, so implementations need no locking.
+type Sink interface {
+	Write(frame Frame, deadline time.Time) error
+	// Ping keeps the connection and any proxies in between alive.
+	Ping(deadline time.Time) error
+	// Close is called once, after the last write; code and text follow
+	// WebSocket close codes.
+	Close(code int, text string, deadline time.Time) error
+}
+
+type connSink struct {
+	conn *websocket.Conn
+}
+
+func NewConnSink(conn *websocket.Conn) Sink {
+	return &connSink{conn: conn}
+}
+
+func (s *connSink) Write(frame Frame, deadline time.Time) error {
+	s.conn.SetWriteDeadline(deadline)
+	return s.conn.WriteMessage(websocket.TextMessage, frame.Data)
+}
+
+func (s *connSink) Ping(deadline time.Time) error {
+	s.conn.SetWriteDeadline(deadline)
+	return s.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (s *connSink) Close(code int, text string, deadline time.Time) error {
+	s.conn.SetWriteDeadline(deadline)
+	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+	return s.conn.Close()
+}
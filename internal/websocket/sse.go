@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// eventStreamSink writes frames as Server-Sent Events. Notification frames
+// carry their ID as the event ID, which the browser sends back as
+// Last-Event-ID when it reconnects.
+type eventStreamSink struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewEventStreamSink starts a text/event-stream response. The handler must
+// not return before the client using the sink has stopped.
+func NewEventStreamSink(w http.ResponseWriter) (Sink, error) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	return &eventStreamSink{w: w, rc: rc}, nil
+}
+
+func (s *eventStreamSink) Write(frame Frame, deadline time.Time) error {
+	s.rc.SetWriteDeadline(deadline)
+
+	if frame.ID != "" {
+		if _, err := fmt.Fprintf(s.w, "id: %s\n", frame.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", frame.Event, frame.Data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Ping sends a comment line, which EventSource ignores but which keeps
+// proxies from timing out an idle response.
+func (s *eventStreamSink) Ping(deadline time.Time) error {
+	s.rc.SetWriteDeadline(deadline)
+
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Close has nothing to send: the stream ends when the handler returns.
+func (s *eventStreamSink) Close(code int, text string, deadline time.Time) error {
+	return nil
+}